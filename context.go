@@ -6,8 +6,27 @@ type jsonContextOption int
 
 const (
 	jsonOptionPublic jsonContextOption = iota
+	jsonOptionGroupConcurrency
+	jsonOptionGroupState
+	jsonOptionGroupCache
+	jsonOptionGroupMaxRounds
+	jsonOptionGroupAttached
+	jsonOptionGroupObserver
+	jsonOptionGroupErrorPolicy
+	jsonOptionGroupRegistry
+	jsonOptionScopes
+	jsonOptionStrict
+	jsonOptionRedactor
+	jsonOptionFields
+	jsonOptionFieldFilter
+	jsonOptionMarshalOptions
+	jsonOptionUnmarshalOptions
 )
 
+// ContextPublic returns a context marking encodings and decodings as public,
+// such as responses to and requests from clients. Public encodings omit fields
+// marked "protect", and public decodings ignore fields marked "protect" or
+// "readonly".
 func ContextPublic(parent context.Context) context.Context {
 	return context.WithValue(parent, jsonOptionPublic, true)
 }
@@ -16,3 +35,148 @@ func isPublic(ctx context.Context) bool {
 	v, ok := ctx.Value(jsonOptionPublic).(bool)
 	return ok && v
 }
+
+// ContextFields returns a context restricting encodings to the fields
+// selected by paths, such as "id", "name" or "owner.name". Paths apply to
+// struct fields and map keys at every nesting level, selecting a field
+// selects all of its subfields, and values of fields not selected are not
+// encoded at all. Marshalers receive a context restricted to the fields
+// selected for their value.
+func ContextFields(parent context.Context, paths ...string) context.Context {
+	return context.WithValue(parent, jsonOptionFields, newFieldSet(paths))
+}
+
+func contextFields(ctx context.Context) *fieldSet {
+	f, _ := ctx.Value(jsonOptionFields).(*fieldSet)
+	return f
+}
+
+// ContextFieldFilter returns a context making encodings call filter for each
+// struct field to decide whether it is encoded.
+func ContextFieldFilter(parent context.Context, filter FieldFilter) context.Context {
+	return context.WithValue(parent, jsonOptionFieldFilter, filter)
+}
+
+func fieldFilterFromContext(ctx context.Context) FieldFilter {
+	f, _ := ctx.Value(jsonOptionFieldFilter).(FieldFilter)
+	return f
+}
+
+// ContextRedactor returns a context making encodings write sensitive fields
+// using r instead of omitting them or writing their value. See Redactor.
+func ContextRedactor(parent context.Context, r Redactor) context.Context {
+	return context.WithValue(parent, jsonOptionRedactor, r)
+}
+
+func redactorFromContext(ctx context.Context) Redactor {
+	r, _ := ctx.Value(jsonOptionRedactor).(Redactor)
+	return r
+}
+
+// ContextStrict returns a context making decodings in public mode fail when
+// the input sets a field that cannot be set, instead of silently ignoring it:
+// a field marked "readonly" fails with a ReadonlyFieldError, and a field marked
+// "protect" fails with a ProtectedFieldError.
+//
+// Decodings that are not public set these fields, so that trusted input such
+// as stored documents or the output of Marshal round-trips. Fields marked
+// "writeonly" are omitted by every encoding, since any output may reach a
+// client.
+func ContextStrict(parent context.Context) context.Context {
+	return context.WithValue(parent, jsonOptionStrict, true)
+}
+
+func isStrict(ctx context.Context) bool {
+	v, ok := ctx.Value(jsonOptionStrict).(bool)
+	return ok && v
+}
+
+// ContextScopes returns a context granting scopes to the encoding. Fields
+// with a scope tag option, such as `json:"email,scope=owner|admin"`, are
+// only encoded if one of their scopes is granted. Scoped fields are encoded
+// without restriction unless ContextScopes or ContextPublic is used.
+func ContextScopes(parent context.Context, scopes ...string) context.Context {
+	return context.WithValue(parent, jsonOptionScopes, append([]string{}, scopes...))
+}
+
+func contextScopes(ctx context.Context) []string {
+	v, _ := ctx.Value(jsonOptionScopes).([]string)
+	return v
+}
+
+// ContextGroupConcurrency returns a context limiting how many group resolvers
+// may run at the same time during a single resolution round. A value of zero
+// or less means no limit, which is the default.
+func ContextGroupConcurrency(parent context.Context, n int) context.Context {
+	return context.WithValue(parent, jsonOptionGroupConcurrency, n)
+}
+
+func groupConcurrency(ctx context.Context) int {
+	v, _ := ctx.Value(jsonOptionGroupConcurrency).(int)
+	return v
+}
+
+func groupStateFromContext(ctx context.Context) *GroupState {
+	st, _ := ctx.Value(jsonOptionGroupState).(*GroupState)
+	return st
+}
+
+// ContextGroupCache returns a context using cache to store values resolved by
+// GroupState, so that they can be reused across encodings.
+func ContextGroupCache(parent context.Context, cache GroupCache) context.Context {
+	return context.WithValue(parent, jsonOptionGroupCache, cache)
+}
+
+func groupCacheFromContext(ctx context.Context) GroupCache {
+	c, _ := ctx.Value(jsonOptionGroupCache).(GroupCache)
+	return c
+}
+
+// ContextGroupMaxRounds returns a context limiting the number of group
+// resolution rounds of an encoding. Once the limit is reached, encoding fails
+// with a GroupRoundsExceededError. A value of zero or less means no limit,
+// which is the default.
+func ContextGroupMaxRounds(parent context.Context, n int) context.Context {
+	return context.WithValue(parent, jsonOptionGroupMaxRounds, n)
+}
+
+func groupMaxRounds(ctx context.Context) int {
+	v, _ := ctx.Value(jsonOptionGroupMaxRounds).(int)
+	return v
+}
+
+// ContextGroupState returns a context making encodings and decodings use st
+// as their GroupState, so that values seeded in st or resolved by previous
+// uses of st do not need to be resolved again.
+func ContextGroupState(parent context.Context, st *GroupState) context.Context {
+	return context.WithValue(parent, jsonOptionGroupAttached, st)
+}
+
+func groupStateAttached(ctx context.Context) *GroupState {
+	st, _ := ctx.Value(jsonOptionGroupAttached).(*GroupState)
+	return st
+}
+
+// ContextGroupObserver returns a context notifying obs of the group resolution
+// work done by encodings and decodings.
+func ContextGroupObserver(parent context.Context, obs GroupObserver) context.Context {
+	return context.WithValue(parent, jsonOptionGroupObserver, obs)
+}
+
+func groupObserverFromContext(ctx context.Context) GroupObserver {
+	obs, _ := ctx.Value(jsonOptionGroupObserver).(GroupObserver)
+	return obs
+}
+
+// ContextGroupErrorPolicy returns a context setting how GroupMarshaler values
+// failing because of group errors are rendered. When the policy allows values
+// to be rendered in a degraded form, the encoding returns its output along
+// with a GroupPartialError.
+func ContextGroupErrorPolicy(parent context.Context, p GroupErrorPolicy) context.Context {
+	return context.WithValue(parent, jsonOptionGroupErrorPolicy, p)
+}
+
+func groupErrorPolicy(ctx context.Context) GroupErrorPolicy {
+	p, _ := ctx.Value(jsonOptionGroupErrorPolicy).(GroupErrorPolicy)
+	return p
+}
@@ -116,7 +116,8 @@ func Unmarshal(data []byte, v any) error {
 }
 
 // UnmarshalContext is like Unmarshal but accepts a context that can be
-// used by types implementing UnmarshalerContext.
+// used by types implementing UnmarshalerContext. The [UnmarshalOptions]
+// carried by ctx, if any, are applied to the decoding.
 func UnmarshalContext(ctx context.Context, data []byte, v any) error {
 	// Check for well-formedness.
 	// Avoids filling out half a data structure
@@ -147,6 +148,14 @@ type UnmarshalerContext interface {
 	UnmarshalContextJSON(context.Context, []byte) error
 }
 
+// TextUnmarshalerContext is the interface implemented by an object that can
+// unmarshal a textual representation of itself and needs access to a
+// context. It is used like encoding.TextUnmarshaler, for values as well as
+// map keys.
+type TextUnmarshalerContext interface {
+	UnmarshalContextText(ctx context.Context, text []byte) error
+}
+
 // An UnmarshalTypeError describes a JSON value that was
 // not appropriate for a value of a specific Go type.
 type UnmarshalTypeError struct {
@@ -164,6 +173,28 @@ func (e *UnmarshalTypeError) Error() string {
 	return "json: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
 }
 
+// A ProtectedFieldError describes a JSON object key matching a struct field
+// marked "protect", when decoding in public mode with ContextStrict.
+type ProtectedFieldError struct {
+	Struct string // name of the struct type containing the field
+	Field  string // the full path from root node to the field
+}
+
+func (e *ProtectedFieldError) Error() string {
+	return "json: cannot set protected Go struct field " + e.Struct + "." + e.Field
+}
+
+// A ReadonlyFieldError describes a JSON object key matching a struct field
+// marked "readonly", when decoding in public mode with ContextStrict.
+type ReadonlyFieldError struct {
+	Struct string // name of the struct type containing the field
+	Field  string // the full path from root node to the field
+}
+
+func (e *ReadonlyFieldError) Error() string {
+	return "json: cannot set read-only Go struct field " + e.Struct + "." + e.Field
+}
+
 // An UnmarshalFieldError describes a JSON object key that
 // led to an unexported (and therefore unwritable) struct field.
 //
@@ -201,6 +232,18 @@ func (d *decodeState) unmarshal(v any) error {
 		return &InvalidUnmarshalError{reflect.TypeOf(v)}
 	}
 
+	d.public, d.strict = false, false
+	d.ctxDone, d.ctxTicks = nil, 0
+	if d.ctx != nil {
+		d.public = isPublic(d.ctx)
+		d.strict = isStrict(d.ctx)
+		d.ctxDone = d.ctx.Done()
+		if o := unmarshalOptionsFromContext(d.ctx); o != nil {
+			d.useNumber = d.useNumber || o.UseNumber
+			d.disallowUnknownFields = d.disallowUnknownFields || o.DisallowUnknownFields
+		}
+	}
+
 	d.scan.reset()
 	d.scanWhile(scanSkipSpace)
 	// We decode rv not rv.Elem because the Unmarshaler interface
@@ -209,6 +252,9 @@ func (d *decodeState) unmarshal(v any) error {
 	if err != nil {
 		return d.addErrorContext(err)
 	}
+	if err := d.resolveGroups(); err != nil {
+		return err
+	}
 	return d.savedError
 }
 
@@ -245,6 +291,13 @@ type decodeState struct {
 	useNumber             bool
 	disallowUnknownFields bool
 	ctx                   context.Context
+	public                bool            // if true, fields marked "protect" or "readonly" are not set
+	strict                bool            // if true, protected and read-only fields are reported as errors in public mode
+	ctxDone               <-chan struct{} // done channel of ctx, nil if it cannot be canceled
+	ctxTicks              int             // elements decoded since ctx was last checked
+	groupSt               *GroupState     // state for group decoding
+	groupPending          []groupDeferred // values waiting for group resolution
+	groupStores           []groupStore    // copies of pending values moved by their container
 }
 
 // readIndex returns the position of the last byte read.
@@ -261,6 +314,9 @@ func (d *decodeState) init(data []byte) *decodeState {
 	d.data = data
 	d.off = 0
 	d.savedError = nil
+	d.groupSt = nil
+	d.groupPending = nil
+	d.groupStores = nil
 	if d.errorContext != nil {
 		d.errorContext.Struct = nil
 		// Reuse the allocated space for the FieldStack slice.
@@ -277,6 +333,34 @@ func (d *decodeState) saveError(err error) {
 	}
 }
 
+// fieldPath returns the full path from root node to field f of the object
+// being decoded.
+func (d *decodeState) fieldPath(f *field) string {
+	var path []string
+	if d.errorContext != nil {
+		path = append(path, d.errorContext.FieldStack...)
+	}
+	path = append(path, f.name)
+	return strings.Join(path, ".")
+}
+
+// checkContext returns an error wrapping the error of the context of the
+// decoding if it is done. The context is only checked every
+// contextCheckInterval calls.
+func (d *decodeState) checkContext() error {
+	if d.ctxDone == nil {
+		return nil
+	}
+	if d.ctxTicks++; d.ctxTicks < contextCheckInterval {
+		return nil
+	}
+	d.ctxTicks = 0
+	if err := d.ctx.Err(); err != nil {
+		return fmt.Errorf("json: decoding canceled: %w", err)
+	}
+	return nil
+}
+
 // addErrorContext returns a new error enhanced with information from d.errorContext
 func (d *decodeState) addErrorContext(err error) error {
 	if d.errorContext != nil && (d.errorContext.Struct != nil || len(d.errorContext.FieldStack) > 0) {
@@ -455,7 +539,7 @@ func (d *decodeState) valueQuoted() any {
 // If it encounters an Unmarshaler, indirect stops and returns that.
 // If decodingNull is true, indirect stops at the first settable pointer so it
 // can be set to nil.
-func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, UnmarshalerContext, encoding.TextUnmarshaler, reflect.Value) {
+func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, UnmarshalerContext, GroupUnmarshaler, encoding.TextUnmarshaler, TextUnmarshalerContext, reflect.Value) {
 	// Issue #24153 indicates that it is generally not a guaranteed property
 	// that you may round-trip a reflect.Value by calling Value.Addr().Elem()
 	// and expect the value to still be settable for values derived from
@@ -508,15 +592,21 @@ func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, UnmarshalerConte
 			v.Set(reflect.New(v.Type().Elem()))
 		}
 		if v.Type().NumMethod() > 0 && v.CanInterface() {
+			if u, ok := v.Interface().(GroupUnmarshaler); ok {
+				return nil, nil, u, nil, nil, reflect.Value{}
+			}
 			if u, ok := v.Interface().(Unmarshaler); ok {
-				return u, nil, nil, reflect.Value{}
+				return u, nil, nil, nil, nil, reflect.Value{}
 			}
 			if u, ok := v.Interface().(UnmarshalerContext); ok {
-				return nil, u, nil, reflect.Value{}
+				return nil, u, nil, nil, nil, reflect.Value{}
 			}
 			if !decodingNull {
+				if u, ok := v.Interface().(TextUnmarshalerContext); ok {
+					return nil, nil, nil, nil, u, reflect.Value{}
+				}
 				if u, ok := v.Interface().(encoding.TextUnmarshaler); ok {
-					return nil, nil, u, reflect.Value{}
+					return nil, nil, nil, u, nil, reflect.Value{}
 				}
 			}
 		}
@@ -528,14 +618,19 @@ func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, UnmarshalerConte
 			v = v.Elem()
 		}
 	}
-	return nil, nil, nil, v
+	return nil, nil, nil, nil, nil, v
 }
 
 // array consumes an array from d.data[d.off-1:], decoding into v.
 // The first byte of the array ('[') has been read already.
 func (d *decodeState) array(v reflect.Value) error {
 	// Check for unmarshaler.
-	u, uc, ut, pv := indirect(v, false)
+	u, uc, ug, ut, utc, pv := indirect(v, false)
+	if ug != nil {
+		start := d.readIndex()
+		d.skip()
+		return d.groupUnmarshal(ug, d.data[start:d.off])
+	}
 	if u != nil {
 		start := d.readIndex()
 		d.skip()
@@ -546,7 +641,7 @@ func (d *decodeState) array(v reflect.Value) error {
 		d.skip()
 		return uc.UnmarshalContextJSON(d.ctx, d.data[start:d.off])
 	}
-	if ut != nil {
+	if ut != nil || utc != nil {
 		d.saveError(&UnmarshalTypeError{Value: "array", Type: v.Type(), Offset: int64(d.off)})
 		d.skip()
 		return nil
@@ -572,6 +667,10 @@ func (d *decodeState) array(v reflect.Value) error {
 		break
 	}
 
+	// Elements holding values waiting for group resolution, which must be
+	// copied to their final location if the slice is reallocated.
+	var pending []int
+	var pendingElems []reflect.Value
 	i := 0
 	for {
 		// Look ahead for ] - can only happen on first iteration.
@@ -592,9 +691,14 @@ func (d *decodeState) array(v reflect.Value) error {
 
 		if i < v.Len() {
 			// Decode into element.
+			n := len(d.groupPending)
 			if err := d.value(v.Index(i)); err != nil {
 				return err
 			}
+			if v.Kind() == reflect.Slice && len(d.groupPending) > n {
+				pending = append(pending, i)
+				pendingElems = append(pendingElems, v.Index(i))
+			}
 		} else {
 			// Ran out of fixed array: skip.
 			if err := d.value(reflect.Value{}); err != nil {
@@ -613,6 +717,9 @@ func (d *decodeState) array(v reflect.Value) error {
 		if d.opcode != scanArrayValue {
 			panic(phasePanicMsg)
 		}
+		if err := d.checkContext(); err != nil {
+			return err
+		}
 	}
 
 	if i < v.Len() {
@@ -627,17 +734,30 @@ func (d *decodeState) array(v reflect.Value) error {
 	if i == 0 && v.Kind() == reflect.Slice {
 		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
 	}
+	for n, i := range pending {
+		// pendingElems[n] is in the backing array used when it was decoded
+		dst, src := v.Index(i), pendingElems[n]
+		if dst.Addr().UnsafePointer() != src.Addr().UnsafePointer() {
+			d.groupStores = append(d.groupStores, groupStore{dst: dst, src: src})
+		}
+	}
 	return nil
 }
 
 var nullLiteral = []byte("null")
 var textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+var ctxTextUnmarshalerType = reflect.TypeFor[TextUnmarshalerContext]()
 
 // object consumes an object from d.data[d.off-1:], decoding into v.
 // The first byte ('{') of the object has been read already.
 func (d *decodeState) object(v reflect.Value) error {
 	// Check for unmarshaler.
-	u, uc, ut, pv := indirect(v, false)
+	u, uc, ug, ut, utc, pv := indirect(v, false)
+	if ug != nil {
+		start := d.readIndex()
+		d.skip()
+		return d.groupUnmarshal(ug, d.data[start:d.off])
+	}
 	if u != nil {
 		start := d.readIndex()
 		d.skip()
@@ -648,7 +768,7 @@ func (d *decodeState) object(v reflect.Value) error {
 		d.skip()
 		return uc.UnmarshalContextJSON(d.ctx, d.data[start:d.off])
 	}
-	if ut != nil {
+	if ut != nil || utc != nil {
 		d.saveError(&UnmarshalTypeError{Value: "object", Type: v.Type(), Offset: int64(d.off)})
 		d.skip()
 		return nil
@@ -678,7 +798,7 @@ func (d *decodeState) object(v reflect.Value) error {
 			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		default:
-			if !reflect.PointerTo(t.Key()).Implements(textUnmarshalerType) {
+			if !reflect.PointerTo(t.Key()).Implements(textUnmarshalerType) && !reflect.PointerTo(t.Key()).Implements(ctxTextUnmarshalerType) {
 				d.saveError(&UnmarshalTypeError{Value: "object", Type: t, Offset: int64(d.off)})
 				d.skip()
 				return nil
@@ -739,7 +859,18 @@ func (d *decodeState) object(v reflect.Value) error {
 			if f == nil {
 				f = fields.byFoldedName[string(foldName(key))]
 			}
-			if f != nil {
+			if f != nil && d.public && f.protect {
+				// Skip protected fields when decoding in public mode
+				if d.strict {
+					d.saveError(&ProtectedFieldError{Struct: t.Name(), Field: d.fieldPath(f)})
+				}
+			} else if f != nil && d.public && f.readOnly {
+				// Skip read-only fields when decoding in public mode, trusted
+				// input may set them so that encoded values round-trip
+				if d.strict {
+					d.saveError(&ReadonlyFieldError{Struct: t.Name(), Field: d.fieldPath(f)})
+				}
+			} else if f != nil {
 				subv = v
 				destring = f.quoted
 				if d.errorContext == nil {
@@ -789,6 +920,7 @@ func (d *decodeState) object(v reflect.Value) error {
 		}
 		d.scanWhile(scanSkipSpace)
 
+		n := len(d.groupPending)
 		if destring {
 			switch qv := d.valueQuoted().(type) {
 			case nil:
@@ -813,7 +945,7 @@ func (d *decodeState) object(v reflect.Value) error {
 		if v.Kind() == reflect.Map {
 			kt := t.Key()
 			var kv reflect.Value
-			if reflect.PointerTo(kt).Implements(textUnmarshalerType) {
+			if reflect.PointerTo(kt).Implements(textUnmarshalerType) || reflect.PointerTo(kt).Implements(ctxTextUnmarshalerType) {
 				kv = reflect.New(kt)
 				if err := d.literalStore(item, kv, true); err != nil {
 					return err
@@ -848,6 +980,12 @@ func (d *decodeState) object(v reflect.Value) error {
 			}
 			if kv.IsValid() {
 				v.SetMapIndex(kv, subv)
+				if len(d.groupPending) > n {
+					// The map holds a copy of mapElem, store it again
+					// once its groups are resolved.
+					d.groupStores = append(d.groupStores, groupStore{m: v, key: kv, src: mapElem})
+					mapElem = reflect.Value{}
+				}
 			}
 		}
 
@@ -868,6 +1006,9 @@ func (d *decodeState) object(v reflect.Value) error {
 		if d.opcode != scanObjectValue {
 			panic(phasePanicMsg)
 		}
+		if err := d.checkContext(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -900,14 +1041,17 @@ func (d *decodeState) literalStore(item []byte, v reflect.Value, fromQuoted bool
 		return nil
 	}
 	isNull := item[0] == 'n' // null
-	u, uc, ut, pv := indirect(v, isNull)
+	u, uc, ug, ut, utc, pv := indirect(v, isNull)
+	if ug != nil {
+		return d.groupUnmarshal(ug, item)
+	}
 	if u != nil {
 		return u.UnmarshalJSON(item)
 	}
 	if uc != nil {
 		return uc.UnmarshalContextJSON(d.ctx, item)
 	}
-	if ut != nil {
+	if ut != nil || utc != nil {
 		if item[0] != '"' {
 			if fromQuoted {
 				d.saveError(fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal %q into %v", item, v.Type()))
@@ -930,6 +1074,9 @@ func (d *decodeState) literalStore(item []byte, v reflect.Value, fromQuoted bool
 			}
 			panic(phasePanicMsg)
 		}
+		if utc != nil {
+			return utc.UnmarshalContextText(d.ctx, s)
+		}
 		return ut.UnmarshalText(s)
 	}
 
@@ -1112,6 +1259,12 @@ func (d *decodeState) arrayInterface() []any {
 		if d.opcode != scanArrayValue {
 			panic(phasePanicMsg)
 		}
+		if err := d.checkContext(); err != nil {
+			// skip the rest of the array
+			d.saveError(err)
+			d.skip()
+			break
+		}
 	}
 	return v
 }
@@ -1161,6 +1314,12 @@ func (d *decodeState) objectInterface() map[string]any {
 		if d.opcode != scanObjectValue {
 			panic(phasePanicMsg)
 		}
+		if err := d.checkContext(); err != nil {
+			// skip the rest of the object
+			d.saveError(err)
+			d.skip()
+			break
+		}
 	}
 	return m
 }
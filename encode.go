@@ -215,22 +215,38 @@ func Marshal(v any) ([]byte, error) {
 	}
 	buf := append([]byte(nil), e.Bytes()...)
 
-	return buf, nil
+	return buf, e.groupSt.partialError()
 }
 
-// MarshalContext is the same as Marshal but with a context
+// MarshalContext is the same as Marshal but with a context. When called with
+// the context received by GroupMarshalerJSON, the encoding joins the group
+// batch of the outer encoding, see [GroupState.Marshal].
+//
+// If values were rendered in a degraded form as allowed by their
+// [GroupErrorPolicy], the output is returned along with a [GroupPartialError].
+//
+// The [MarshalOptions] carried by ctx, if any, are applied to the encoding.
 func MarshalContext(ctx context.Context, v any) ([]byte, error) {
+	if st := groupStateFromContext(ctx); st != nil {
+		return st.Marshal(ctx, v)
+	}
 	e := newEncodeState()
 	e.setContext(ctx)
 	defer encodeStatePool.Put(e)
 
-	err := e.marshal(v, encOpts{escapeHTML: true})
+	err := e.marshal(v, encOptsFromContext(ctx))
 	if err != nil {
 		return nil, err
 	}
 	buf := append([]byte(nil), e.Bytes()...)
+	if o := marshalOptionsFromContext(ctx); o != nil && (o.Prefix != "" || o.Indent != "") {
+		buf, err = appendIndent(make([]byte, 0, indentGrowthFactor*len(buf)), buf, o.Prefix, o.Indent)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return buf, nil
+	return buf, e.groupSt.partialError()
 }
 
 // MarshalIndent is like [Marshal] but applies [Indent] to format the output.
@@ -238,15 +254,16 @@ func MarshalContext(ctx context.Context, v any) ([]byte, error) {
 // followed by one or more copies of indent according to the indentation nesting.
 func MarshalIndent(v any, prefix, indent string) ([]byte, error) {
 	b, err := Marshal(v)
-	if err != nil {
+	var perr *GroupPartialError
+	if err != nil && !errors.As(err, &perr) {
 		return nil, err
 	}
 	b2 := make([]byte, 0, indentGrowthFactor*len(b))
-	b2, err = appendIndent(b2, b, prefix, indent)
-	if err != nil {
-		return nil, err
+	b2, ierr := appendIndent(b2, b, prefix, indent)
+	if ierr != nil {
+		return nil, ierr
 	}
-	return b2, nil
+	return b2, err
 }
 
 // Marshaler is the interface implemented by types that
@@ -261,6 +278,13 @@ type MarshalerContext interface {
 	MarshalContextJSON(ctx context.Context) ([]byte, error)
 }
 
+// TextMarshalerContext is the interface implemented by types that can
+// marshal themselves into a textual form while requiring a context. It is
+// used like encoding.TextMarshaler, for values as well as map keys.
+type TextMarshalerContext interface {
+	MarshalContextText(ctx context.Context) ([]byte, error)
+}
+
 // An UnsupportedTypeError is returned by [Marshal] when attempting
 // to encode an unsupported value type.
 type UnsupportedTypeError struct {
@@ -331,27 +355,92 @@ type encodeState struct {
 	ptrLevel uint
 	ptrSeen  map[any]struct{}
 
-	ctx     context.Context // context, made available for methods using context
-	groupSt *GroupState     // state for group encoding
-	public  bool            // if true, fields marked "protect" will not be exported
+	ctx         context.Context // context, made available for methods using context
+	groupSt     *GroupState     // state for group encoding
+	groupCtx    context.Context // ctx carrying groupSt, passed to GroupMarshalerJSON
+	groupNested bool            // if true, groupSt is resolved by an outer encoding
+	groupCache  GroupCache      // cache used by groupSt, if any
+	groupFull   bool            // if true, a retry needs to encode the whole value again
+	groupHoles  []groupHole     // values waiting for group resolution, by position
+	public      bool            // if true, fields marked "protect" will not be exported
+	scopes      []string        // scopes granted by the context, nil if not restricted
+	redactor    Redactor        // redactor set by the context, if any
+	fields      *fieldSet       // fields selected at the current node, nil if all
+	fieldFilter FieldFilter     // filter set by the context, if any
+	ctxFields   *fieldSet       // fields selected by ctx
+	ctxDone     <-chan struct{} // done channel of ctx, nil if it cannot be canceled
+	ctxTicks    int             // elements encoded since ctx was last checked
 }
 
 func (e *encodeState) setContext(ctx context.Context) {
 	e.ctx = ctx
+	e.ctxDone = ctx.Done()
 	if isPublic(ctx) {
 		e.public = true
 	}
+	e.scopes = contextScopes(ctx)
+	e.redactor = redactorFromContext(ctx)
+	e.ctxFields = contextFields(ctx)
+	e.fieldFilter = fieldFilterFromContext(ctx)
+	e.fields = e.ctxFields
+	e.groupCache = groupCacheFromContext(ctx)
+	e.groupSt = groupStateAttached(ctx)
+}
+
+// granted reports whether one of scopes is granted to the encoding. Scopes are
+// only restricted in public mode or if the context sets scopes.
+func (e *encodeState) granted(scopes []string) bool {
+	if e.scopes == nil && !e.public {
+		return true
+	}
+	for _, s := range scopes {
+		if slices.Contains(e.scopes, s) {
+			return true
+		}
+	}
+	return false
 }
 
 const startDetectingCyclesAfter = 1000
 
+// contextCheckInterval is the number of array or map elements encoded or
+// decoded between checks of the context for cancellation.
+const contextCheckInterval = 1024
+
+// checkContext aborts the encoding if its context is done. The context is
+// only checked every contextCheckInterval calls.
+func (e *encodeState) checkContext() {
+	if e.ctxDone == nil {
+		return
+	}
+	if e.ctxTicks++; e.ctxTicks < contextCheckInterval {
+		return
+	}
+	e.ctxTicks = 0
+	if err := e.ctx.Err(); err != nil {
+		e.error(fmt.Errorf("json: encoding canceled: %w", err))
+	}
+}
+
 var encodeStatePool sync.Pool
 
 func newEncodeState() *encodeState {
 	if v := encodeStatePool.Get(); v != nil {
 		e := v.(*encodeState)
 		e.groupSt = nil
+		e.groupCtx = nil
+		e.groupNested = false
+		e.groupFull = false
+		clear(e.groupHoles)
+		e.groupHoles = e.groupHoles[:0]
 		e.public = false
+		e.scopes = nil
+		e.redactor = nil
+		e.fields = nil
+		e.ctxFields = nil
+		e.fieldFilter = nil
+		e.ctxDone = nil
+		e.ctxTicks = 0
 		e.Reset()
 		if len(e.ptrSeen) > 0 {
 			panic("ptrEncoder.encode should have emptied ptrSeen via defers")
@@ -377,23 +466,92 @@ func (e *encodeState) marshal(v any, opts encOpts) (err error) {
 			}
 		}
 	}()
-	for {
-		pos := e.Buffer.Len()
+	if e.groupNested {
+		// groupSt belongs to an outer encoding, which will resolve pending
+		// groups and retry
+		n := e.groupSt.needRetry
 		e.reflectValue(reflect.ValueOf(v), opts)
-		if !e.groupSt.retry(e.ctx) {
+		if e.groupSt.needRetry != n {
+			return ErrRetryNeeded
+		}
+		return nil
+	}
+	e.groupSt.resetRun()
+	start := e.Buffer.Len()
+	e.reflectValue(reflect.ValueOf(v), opts)
+	for {
+		retry, err := e.groupSt.retry(e.ctx)
+		if err != nil {
+			return err
+		}
+		if !retry {
+			break
+		}
+		e.groupRetry(start, v, opts)
+	}
+	return nil
+}
+
+// marshalBatch is like marshal for several values, each encoded in its own
+// encodeState, sharing the GroupState of the first one so that their groups
+// are resolved together.
+func marshalBatch(es []*encodeState, vs []any, opts encOpts) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if je, ok := r.(jsonError); ok {
+				err = je.error
+			} else {
+				panic(r)
+			}
+		}
+	}()
+	st, _ := es[0].groupState()
+	st.resetRun()
+	for n, e := range es {
+		e.groupSt = st
+		e.reflectValue(reflect.ValueOf(vs[n]), opts)
+	}
+	for {
+		retry, err := st.retry(es[0].ctx)
+		if err != nil {
+			return err
+		}
+		if !retry {
 			break
 		}
-		// rewind buffer & try again
-		e.Buffer.Truncate(pos)
+		for n, e := range es {
+			if e.groupFull || len(e.groupHoles) > 0 {
+				e.groupRetry(0, vs[n], opts)
+			}
+		}
 	}
 	return nil
 }
 
+// groupRetry renders again the parts of the buffer from start that needed
+// group resolution, or all of v if some could not be deferred.
+func (e *encodeState) groupRetry(start int, v any, opts encOpts) {
+	if e.groupFull {
+		// a value could not be deferred, rewind buffer & try again
+		e.groupFull = false
+		clear(e.groupHoles)
+		e.groupHoles = e.groupHoles[:0]
+		e.Buffer.Truncate(start)
+		e.reflectValue(reflect.ValueOf(v), opts)
+		return
+	}
+	e.fillGroupHoles(start)
+}
+
 // error aborts the encoding by panicking with err wrapped in jsonError.
 func (e *encodeState) error(err error) {
 	if errors.Is(err, ErrRetryNeeded) {
-		// if ErrRetryNeeded, just mark retry needed and do not panic
-		e.groupSt.bumpRetry()
+		// if ErrRetryNeeded, just mark retry needed and do not panic. The
+		// value cannot be spliced later, so the whole value will be encoded
+		// again.
+		st, _ := e.groupState()
+		st.bumpRetry()
+		e.groupFull = true
 		return
 	}
 	panic(jsonError{err})
@@ -462,10 +620,11 @@ func typeEncoder(t reflect.Type) encoderFunc {
 }
 
 var (
-	marshalerType      = reflect.TypeFor[Marshaler]()
-	ctxMarshalerType   = reflect.TypeFor[MarshalerContext]()
-	groupMarshalerType = reflect.TypeFor[GroupMarshaler]()
-	textMarshalerType  = reflect.TypeFor[encoding.TextMarshaler]()
+	marshalerType        = reflect.TypeFor[Marshaler]()
+	ctxMarshalerType     = reflect.TypeFor[MarshalerContext]()
+	groupMarshalerType   = reflect.TypeFor[GroupMarshaler]()
+	textMarshalerType    = reflect.TypeFor[encoding.TextMarshaler]()
+	ctxTextMarshalerType = reflect.TypeFor[TextMarshalerContext]()
 )
 
 // newTypeEncoder constructs an encoderFunc for a type.
@@ -493,6 +652,12 @@ func newTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
 	if t.Implements(marshalerType) {
 		return marshalerEncoder
 	}
+	if t.Kind() != reflect.Pointer && allowAddr && reflect.PointerTo(t).Implements(ctxTextMarshalerType) {
+		return newCondAddrEncoder(addrCtxTextMarshalerEncoder, newTypeEncoder(t, false))
+	}
+	if t.Implements(ctxTextMarshalerType) {
+		return ctxTextMarshalerEncoder
+	}
 	if t.Kind() != reflect.Pointer && allowAddr && reflect.PointerTo(t).Implements(textMarshalerType) {
 		return newCondAddrEncoder(addrTextMarshalerEncoder, newTypeEncoder(t, false))
 	}
@@ -545,6 +710,7 @@ func marshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		return
 	}
 	b, err := m.MarshalJSON()
+	err = e.absorbPartial(err)
 	if err == nil {
 		e.Grow(len(b))
 		out := e.AvailableBuffer()
@@ -564,6 +730,7 @@ func addrMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 	}
 	m := va.Interface().(Marshaler)
 	b, err := m.MarshalJSON()
+	err = e.absorbPartial(err)
 	if err == nil {
 		e.Grow(len(b))
 		out := e.AvailableBuffer()
@@ -585,7 +752,8 @@ func ctxMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		e.WriteString("null")
 		return
 	}
-	b, err := m.MarshalContextJSON(e.ctx)
+	b, err := m.MarshalContextJSON(e.withFields(e.ctx))
+	err = e.absorbPartial(err)
 	if err == nil {
 		e.Grow(len(b))
 		out := e.AvailableBuffer()
@@ -593,6 +761,10 @@ func ctxMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		e.Buffer.Write(out)
 	}
 	if err != nil {
+		if errors.Is(err, ErrRetryNeeded) {
+			e.deferGroup(v, ctxMarshalerEncoder, opts)
+			return
+		}
 		e.error(&MarshalerError{v.Type(), err, "MarshalContextJSON"})
 	}
 }
@@ -604,7 +776,8 @@ func addrCtxMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		return
 	}
 	m := va.Interface().(MarshalerContext)
-	b, err := m.MarshalContextJSON(e.ctx)
+	b, err := m.MarshalContextJSON(e.withFields(e.ctx))
+	err = e.absorbPartial(err)
 	if err == nil {
 		e.Grow(len(b))
 		out := e.AvailableBuffer()
@@ -612,6 +785,10 @@ func addrCtxMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		e.Buffer.Write(out)
 	}
 	if err != nil {
+		if errors.Is(err, ErrRetryNeeded) {
+			e.deferGroup(v, addrCtxMarshalerEncoder, opts)
+			return
+		}
 		e.error(&MarshalerError{v.Type(), err, "MarshalContextJSON"})
 	}
 }
@@ -647,6 +824,37 @@ func addrTextMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 	e.Write(appendString(e.AvailableBuffer(), b, opts.escapeHTML))
 }
 
+func ctxTextMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		e.WriteString("null")
+		return
+	}
+	m, ok := v.Interface().(TextMarshalerContext)
+	if !ok {
+		e.WriteString("null")
+		return
+	}
+	b, err := m.MarshalContextText(e.withFields(e.ctx))
+	if err != nil {
+		e.error(&MarshalerError{v.Type(), err, "MarshalContextText"})
+	}
+	e.Write(appendString(e.AvailableBuffer(), b, opts.escapeHTML))
+}
+
+func addrCtxTextMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
+	va := v.Addr()
+	if va.IsNil() {
+		e.WriteString("null")
+		return
+	}
+	m := va.Interface().(TextMarshalerContext)
+	b, err := m.MarshalContextText(e.withFields(e.ctx))
+	if err != nil {
+		e.error(&MarshalerError{v.Type(), err, "MarshalContextText"})
+	}
+	e.Write(appendString(e.AvailableBuffer(), b, opts.escapeHTML))
+}
+
 func boolEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 	b := e.AvailableBuffer()
 	b = mayAppendQuote(b, opts.quoted)
@@ -836,8 +1044,30 @@ FieldLoop:
 	for i := range se.fields.list {
 		f := &se.fields.list[i]
 
-		// Skip protected fields when encoding in public mode
+		// Skip fields not selected by the context
+		sub, ok := e.selectField(f.name)
+		if !ok {
+			continue
+		}
+
+		// Skip protected fields when encoding in public mode, unless they
+		// are redacted
+		redact := f.redact && (e.public || e.redactor != nil)
 		if e.public && f.protect {
+			if e.redactor == nil {
+				continue
+			}
+			redact = true
+		}
+		// Never encode write-only fields
+		if f.writeOnly {
+			continue
+		}
+		if e.fieldFilter != nil && !e.fieldFilter(e.ctx, v, *f.info) {
+			continue
+		}
+		// Skip scoped fields unless one of their scopes is granted
+		if f.scopes != nil && !e.granted(f.scopes) {
 			continue
 		}
 
@@ -864,8 +1094,15 @@ FieldLoop:
 		} else {
 			e.WriteString(f.nameNonEsc)
 		}
+		if redact {
+			e.redact(fv, opts)
+			continue
+		}
 		opts.quoted = f.quoted
+		parent := e.fields
+		e.fields = sub
 		f.encoder(e, fv, opts)
+		e.fields = parent
 	}
 	if next == '{' {
 		e.WriteString("{}")
@@ -907,7 +1144,7 @@ func (me mapEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 		err error
 	)
 	for i := 0; mi.Next(); i++ {
-		if sv[i].ks, err = resolveKeyName(mi.Key()); err != nil {
+		if sv[i].ks, err = resolveKeyName(e.ctx, mi.Key()); err != nil {
 			e.error(fmt.Errorf("json: encoding error for type %q: %q", v.Type().String(), err.Error()))
 		}
 		sv[i].v = mi.Value()
@@ -916,13 +1153,23 @@ func (me mapEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 		return strings.Compare(i.ks, j.ks)
 	})
 
-	for i, kv := range sv {
-		if i > 0 {
+	parent := e.fields
+	next := false
+	for _, kv := range sv {
+		sub, ok := e.selectField(kv.ks)
+		if !ok {
+			continue
+		}
+		if next {
 			e.WriteByte(',')
 		}
+		next = true
+		e.checkContext()
 		e.Write(appendString(e.AvailableBuffer(), kv.ks, opts.escapeHTML))
 		e.WriteByte(':')
+		e.fields = sub
 		me.elemEnc(e, kv.v, opts)
+		e.fields = parent
 	}
 	e.WriteByte('}')
 	e.ptrLevel--
@@ -934,7 +1181,7 @@ func newMapEncoder(t reflect.Type) encoderFunc {
 		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 	default:
-		if !t.Key().Implements(textMarshalerType) {
+		if !t.Key().Implements(textMarshalerType) && !t.Key().Implements(ctxTextMarshalerType) {
 			return unsupportedTypeEncoder
 		}
 	}
@@ -989,7 +1236,7 @@ func newSliceEncoder(t reflect.Type) encoderFunc {
 	// Byte slices get special treatment; arrays don't.
 	if t.Elem().Kind() == reflect.Uint8 {
 		p := reflect.PointerTo(t.Elem())
-		if !p.Implements(marshalerType) && !p.Implements(textMarshalerType) {
+		if !p.Implements(marshalerType) && !p.Implements(textMarshalerType) && !p.Implements(ctxTextMarshalerType) {
 			return encodeByteSlice
 		}
 	}
@@ -1008,6 +1255,7 @@ func (ae arrayEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 		if i > 0 {
 			e.WriteByte(',')
 		}
+		e.checkContext()
 		ae.elemEnc(e, v.Index(i), opts)
 	}
 	e.WriteByte(']')
@@ -1097,7 +1345,16 @@ type reflectWithString struct {
 	ks string
 }
 
-func resolveKeyName(k reflect.Value) (string, error) {
+func resolveKeyName(ctx context.Context, k reflect.Value) (string, error) {
+	// TextMarshalerContext is checked before string keys, so that keys and
+	// values of the same type are encoded the same way
+	if tm, ok := k.Interface().(TextMarshalerContext); ok {
+		if k.Kind() == reflect.Pointer && k.IsNil() {
+			return "", nil
+		}
+		buf, err := tm.MarshalContextText(ctx)
+		return string(buf), err
+	}
 	if k.Kind() == reflect.String {
 		return k.String(), nil
 	}
@@ -1202,6 +1459,11 @@ type field struct {
 	isZero    func(reflect.Value) bool
 	quoted    bool
 	protect   bool
+	redact    bool
+	readOnly  bool
+	writeOnly bool
+	scopes    []string
+	info      *FieldInfo
 
 	encoder encoderFunc
 }
@@ -1316,6 +1578,16 @@ func typeFields(t reflect.Type) structFields {
 						omitZero:  opts.Contains("omitzero"),
 						quoted:    quoted,
 						protect:   opts.Contains("protect"),
+						redact:    opts.Contains("redact"),
+						readOnly:  opts.Contains("readonly"),
+						writeOnly: opts.Contains("writeonly"),
+					}
+					field.info = &FieldInfo{Name: name, Index: index}
+					if opts != "" {
+						field.info.Options = strings.Split(string(opts), ",")
+					}
+					if scope, ok := opts.Value("scope"); ok {
+						field.scopes = strings.Split(scope, "|")
 					}
 					field.nameBytes = []byte(field.name)
 
@@ -0,0 +1,31 @@
+package pjson
+
+import (
+	"context"
+	"reflect"
+	"strings"
+)
+
+// FieldFilter decides whether field f of the struct parent is encoded. It is
+// called for each field that would otherwise be encoded, and can implement
+// visibility rules depending on the encoded value.
+type FieldFilter func(ctx context.Context, parent reflect.Value, f FieldInfo) bool
+
+// FieldInfo describes a struct field passed to a FieldFilter. Its slices are
+// shared across encodings and must not be modified.
+type FieldInfo struct {
+	Name    string   // JSON name of the field
+	Index   []int    // index sequence of the Go field, see reflect.Value.FieldByIndex
+	Options []string // options of the json tag, such as "omitempty" or "scope=admin"
+}
+
+// Option returns the value of the json tag option name, and whether it is
+// present. Options without a value, such as "protect", have an empty value.
+func (f FieldInfo) Option(name string) (string, bool) {
+	for _, opt := range f.Options {
+		if n, v, _ := strings.Cut(opt, "="); n == name {
+			return v, true
+		}
+	}
+	return "", false
+}
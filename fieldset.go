@@ -0,0 +1,58 @@
+package pjson
+
+import (
+	"context"
+	"strings"
+)
+
+// fieldSet is a node of the tree of field paths selected with ContextFields.
+// A nil *fieldSet selects all fields.
+type fieldSet struct {
+	fields map[string]*fieldSet
+}
+
+// newFieldSet returns the tree of paths, each path being a list of field
+// names separated by dots. Selecting a field selects all of its subfields.
+func newFieldSet(paths []string) *fieldSet {
+	root := &fieldSet{fields: make(map[string]*fieldSet)}
+	for _, p := range paths {
+		node := root
+		parts := strings.Split(p, ".")
+		for n, name := range parts {
+			sub, ok := node.fields[name]
+			if ok && sub == nil {
+				// all subfields are already selected
+				break
+			}
+			if n == len(parts)-1 {
+				node.fields[name] = nil
+				break
+			}
+			if !ok {
+				sub = &fieldSet{fields: make(map[string]*fieldSet)}
+				node.fields[name] = sub
+			}
+			node = sub
+		}
+	}
+	return root
+}
+
+// selectField returns whether name is selected in the current node of the
+// encoding, and the node of its subfields.
+func (e *encodeState) selectField(name string) (*fieldSet, bool) {
+	if e.fields == nil {
+		return nil, true
+	}
+	sub, ok := e.fields.fields[name]
+	return sub, ok
+}
+
+// withFields returns ctx carrying the fields selected at the current node of
+// the encoding, for marshalers encoding the current value.
+func (e *encodeState) withFields(ctx context.Context) context.Context {
+	if e.fields == e.ctxFields {
+		return ctx
+	}
+	return context.WithValue(ctx, jsonOptionFields, e.fields)
+}
@@ -1,9 +1,16 @@
 package pjson
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // GroupMarshaler is the interface implemented by types that can
@@ -14,6 +21,16 @@ type GroupMarshaler interface {
 	GroupMarshalerJSON(ctx context.Context, st *GroupState) ([]byte, error)
 }
 
+// GroupUnmarshaler is the interface implemented by types that need values
+// from groups to unmarshal themselves. GroupUnmarshalerJSON may return
+// ErrRetryNeeded after calling Fetch on st, in which case it is called again
+// with the same data once the whole document has been decoded and pending
+// groups have been resolved. As with Unmarshaler, data must be copied if it
+// is retained after returning.
+type GroupUnmarshaler interface {
+	GroupUnmarshalerJSON(ctx context.Context, st *GroupState, data []byte) error
+}
+
 var ErrRetryNeeded = errors.New("this value needs state resolution before it can be returned") // this error can only be returned by GroupMarshalerJSON
 
 type groupResolveState struct {
@@ -21,8 +38,131 @@ type groupResolveState struct {
 	err  error
 }
 
+// ErrGroupKeyNotFound is returned by GroupState for keys not returned by their
+// resolver when the group uses the MissingKeyError policy.
+var ErrGroupKeyNotFound = errors.New("group key not found")
+
+// GroupRoundsExceededError is returned when values still need group resolution
+// after the maximum number of rounds set with ContextGroupMaxRounds, or when
+// the context is done between two rounds.
+type GroupRoundsExceededError struct {
+	Rounds  int      // number of resolution rounds performed
+	Pending []string // groups with keys still pending
+	Err     error    // context error, if the context is done
+}
+
+func (e *GroupRoundsExceededError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("json: group resolution aborted after %d rounds with groups %s pending: %s", e.Rounds, strings.Join(e.Pending, ", "), e.Err)
+	}
+	return fmt.Sprintf("json: group resolution exceeded %d rounds with groups %s pending", e.Rounds, strings.Join(e.Pending, ", "))
+}
+
+// Unwrap returns the context error, if any.
+func (e *GroupRoundsExceededError) Unwrap() error { return e.Err }
+
+// A GroupUnmarshalError describes a GroupUnmarshaler failing once pending
+// groups have been resolved during decoding.
+type GroupUnmarshalError struct {
+	Struct string // name of the struct type containing the field
+	Field  string // the full path from the root to the value
+	Err    error
+}
+
+func (e *GroupUnmarshalError) Error() string {
+	if e.Struct != "" || e.Field != "" {
+		return "json: cannot unmarshal Go struct field " + e.Struct + "." + e.Field + ": " + e.Err.Error()
+	}
+	return "json: cannot unmarshal value: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *GroupUnmarshalError) Unwrap() error { return e.Err }
+
+// A GroupError is returned by GroupState when the value of a key could not be
+// resolved, either because its resolver failed or because of an error for
+// this specific key.
+type GroupError struct {
+	Group string
+	Key   string
+	Err   error
+}
+
+func (e *GroupError) Error() string {
+	return "json: cannot resolve key " + e.Key + " of group " + e.Group + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *GroupError) Unwrap() error { return e.Err }
+
+// GroupPartialError is returned along with the encoded output when values were
+// rendered in a degraded form because of group errors, as allowed by their
+// GroupErrorPolicy. When a marshaler returns output along with a
+// GroupPartialError from a nested encoding, the output is used and the errors
+// are reported by the outer encoding.
+type GroupPartialError struct {
+	Errors []*GroupError
+}
+
+func (e *GroupPartialError) Error() string {
+	if len(e.Errors) == 1 {
+		return "json: value rendered in degraded form: " + e.Errors[0].Error()
+	}
+	return fmt.Sprintf("json: %d values rendered in degraded form, first error: %s", len(e.Errors), e.Errors[0])
+}
+
+// Unwrap returns the errors of the degraded values.
+func (e *GroupPartialError) Unwrap() []error {
+	res := make([]error, len(e.Errors))
+	for n, err := range e.Errors {
+		res[n] = err
+	}
+	return res
+}
+
+// GroupErrorPolicy defines how a GroupMarshaler is rendered when fetching its
+// value fails with a GroupError.
+type GroupErrorPolicy int
+
+const (
+	GroupErrorFail     GroupErrorPolicy = iota // abort the encoding (default)
+	GroupErrorFallback                         // render the value using its MarshalJSON method, or null
+	GroupErrorNull                             // render null
+)
+
+// GroupResolveFunc resolves keys of a group, returning values in the same
+// order as keys.
 type GroupResolveFunc func(context.Context, []string) ([]any, error)
 
+// GroupResolveMapFunc resolves keys of a group, returning values indexed by
+// key as well as errors for keys that could not be resolved. Keys missing from
+// both maps are handled according to the MissingKeyPolicy of the group.
+type GroupResolveMapFunc func(context.Context, []string) (map[string]any, map[string]error, error)
+
+// GroupResolveParamsFunc resolves keys of a group fetched with the given
+// params, returning values in the same order as keys.
+type GroupResolveParamsFunc func(ctx context.Context, keys []string, params any) ([]any, error)
+
+// GroupResolveAsyncFunc starts resolving keys of a group and returns a
+// GroupFuture to wait on the results. It should not block.
+type GroupResolveAsyncFunc func(ctx context.Context, keys []string) GroupFuture
+
+// GroupFuture is the handle of an asynchronous group resolution started by a
+// GroupResolveAsyncFunc.
+type GroupFuture interface {
+	// Wait blocks until values are available, returning them in the same order
+	// as the keys passed to the resolver.
+	Wait(ctx context.Context) ([]any, error)
+}
+
+// GroupFutureFunc is an adapter to use a function as a GroupFuture.
+type GroupFutureFunc func(ctx context.Context) ([]any, error)
+
+// Wait calls f(ctx).
+func (f GroupFutureFunc) Wait(ctx context.Context) ([]any, error) {
+	return f(ctx)
+}
+
 type groupCallObj struct {
 	group    string
 	key      string
@@ -38,99 +178,632 @@ func (g *groupCallObj) GroupMarshalerJSON(ctx context.Context, st *GroupState) (
 	if err != nil {
 		return nil, err
 	}
-	return MarshalContext(ctx, res)
+	return st.Marshal(ctx, res)
 }
 
 // GroupState is a struct holding various state information useful during the
-// current encoding
+// current encoding. The state is also made available through the context passed
+// to GroupMarshalerJSON, so that nested calls to MarshalContext join the same
+// batch. It is not safe for concurrent use.
 type GroupState struct {
-	needRetry int
-	data      map[string]*pendingGroupInfo
+	needRetry   int
+	rounds      int
+	totalRounds int           // rounds across all uses of the state, for Stats
+	failures    []*GroupError // group errors of values rendered in degraded form
+	registry    *GroupRegistry
+	data        map[string]*pendingGroupInfo
+	params      map[groupParamsKey]*pendingGroupInfo // partitions of groups fetched with FetchParams
+	cache       GroupCache
+}
+
+// NewGroupState returns a new GroupState, which can be seeded with known
+// values and attached to an encoding or decoding with ContextGroupState or
+// Encoder.SetGroupState.
+func NewGroupState() *GroupState {
+	return newGroupState(nil)
 }
 
-func newGroupState() *GroupState {
-	return &GroupState{data: make(map[string]*pendingGroupInfo)}
+func newGroupState(cache GroupCache) *GroupState {
+	return &GroupState{data: make(map[string]*pendingGroupInfo), cache: cache}
 }
 
 type pendingGroupInfo struct {
+	name     string
+	st       *GroupState
+	opts     groupOptions
 	fn       GroupResolveFunc
+	mapFn    GroupResolveMapFunc
+	asyncFn  GroupResolveAsyncFunc
 	err      error
 	pending  map[string]bool
 	resolved map[string]any
+	keyErr   map[string]error
+	keys     map[string]any // original keys for groups fetched with FetchAs
+	named    bool           // if true, the group was configured from a GroupRegistry by FetchNamed
+	inflight []*groupBatch  // batches started by asynchronous resolvers
+	stat     GroupStat
 }
 
-// retry will return bool if execution should be retried
-func (g *GroupState) retry(ctx context.Context) bool {
+// retry will return bool if execution should be retried, or an error if
+// no further resolution round is allowed
+func (g *GroupState) retry(ctx context.Context) (bool, error) {
 	if g == nil {
-		return false
+		return false, nil
 	}
 	if g.needRetry == 0 {
-		return false
+		return false, nil
 	}
 	g.needRetry = 0
+
+	// collect groups with pending keys, sorted so resolution order does not
+	// depend on map iteration
+	names := make([]string, 0, len(g.data))
+	for name, obj := range g.data {
+		if obj.err == nil && len(obj.pending) > 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	if len(names) == 0 {
+		return false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return false, &GroupRoundsExceededError{Rounds: g.rounds, Pending: names, Err: err}
+	}
+	if max := groupMaxRounds(ctx); max > 0 && g.rounds >= max {
+		return false, &GroupRoundsExceededError{Rounds: g.rounds, Pending: names}
+	}
+	g.rounds += 1
+	g.totalRounds += 1
+	if obs := groupObserverFromContext(ctx); obs != nil {
+		obs.RoundStart(ctx, g.rounds, names)
+	}
+
+	// start asynchronous resolvers of all groups before waiting on any
+	for _, name := range names {
+		g.data[name].start(ctx)
+	}
+
+	if len(names) == 1 {
+		return g.data[names[0]].resolve(ctx), nil
+	}
+
+	// resolve all groups of this round in parallel, each goroutine only
+	// touching its own pendingGroupInfo
+	res := make([]bool, len(names))
+	panics := make([]any, len(names))
+	var sem chan struct{}
+	if n := groupConcurrency(ctx); n > 0 && n < len(names) {
+		sem = make(chan struct{}, n)
+	}
+	var wg sync.WaitGroup
+	for n, name := range names {
+		obj := g.data[name]
+		if sem != nil {
+			sem <- struct{}{}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if sem != nil {
+					<-sem
+				}
+				if r := recover(); r != nil {
+					panics[n] = r
+				}
+			}()
+			res[n] = obj.resolve(ctx)
+		}()
+	}
+	wg.Wait()
+
 	needRetry := false
-	for _, obj := range g.data {
-		if obj.resolve(ctx) {
+	for n := range names {
+		if panics[n] != nil {
+			// forward panic to the encoding goroutine
+			panic(panics[n])
+		}
+		if res[n] {
 			needRetry = true
 		}
 	}
-	return needRetry
+	return needRetry, nil
+}
+
+// Marshal returns the JSON encoding of v as part of the encoding currently
+// using this state. Group fetches performed while encoding v are added to the
+// current batch and ErrRetryNeeded is returned if v cannot be rendered yet, so
+// that the outer encoding resolves them in its own retry loop.
+//
+// Calling MarshalContext with the context passed to GroupMarshalerJSON has
+// the same effect.
+func (g *GroupState) Marshal(ctx context.Context, v any) ([]byte, error) {
+	e := newEncodeState()
+	e.setContext(ctx)
+	defer encodeStatePool.Put(e)
+
+	e.groupSt = g
+	e.groupNested = true
+	if groupStateFromContext(ctx) == g {
+		e.groupCtx = ctx
+	}
+
+	err := e.marshal(v, encOptsFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	buf := append([]byte(nil), e.Bytes()...)
+
+	return buf, nil
+}
+
+// resetRun resets the per-encoding counters and errors of a state, which may
+// be reused across encodings.
+func (g *GroupState) resetRun() {
+	if g == nil {
+		return
+	}
+	g.rounds = 0
+	g.failures = nil
+	// errors are only kept for the current run, so that a failed resolver is
+	// called again by later encodings sharing the state
+	for _, ginfo := range g.data {
+		ginfo.err = nil
+		clear(ginfo.keyErr)
+	}
 }
 
 func (g *GroupState) bumpRetry() {
 	g.needRetry += 1
 }
 
-func (g *GroupState) Fetch(group, key string, resolver GroupResolveFunc) (any, error) {
-	ginfo, ok := g.data[group]
-	if !ok {
-		g.data[group] = &pendingGroupInfo{
-			fn:       resolver,
-			pending:  map[string]bool{key: true},
-			resolved: make(map[string]any),
+// Fetch returns the value for key in group, or ErrRetryNeeded if it still
+// needs to be resolved. Keys found in the GroupCache attached to the encoding,
+// if any, are returned without calling resolver.
+//
+// Only the resolver and options passed the first time a group is seen are used.
+// An error wrapping ErrGroupConflict is returned if the group is registered in
+// the GroupRegistry of the encoding, see FetchNamed.
+func (g *GroupState) Fetch(group, key string, resolver GroupResolveFunc, opts ...GroupOption) (any, error) {
+	ginfo, err := g.ownGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	if !ginfo.hasResolver() {
+		ginfo.fn = resolver
+		ginfo.configure(opts)
+	}
+	return g.fetch(ginfo, key)
+}
+
+// FetchMap is like Fetch but uses a resolver returning values indexed by key.
+func (g *GroupState) FetchMap(group, key string, resolver GroupResolveMapFunc, opts ...GroupOption) (any, error) {
+	ginfo, err := g.ownGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	if !ginfo.hasResolver() {
+		ginfo.mapFn = resolver
+		ginfo.configure(opts)
+	}
+	return g.fetch(ginfo, key)
+}
+
+// FetchParams is like Fetch for a group whose resolver also takes params,
+// such as a projection or a locale. Fetches are partitioned by params: keys
+// fetched with equal params are resolved together in one call receiving those
+// params, so params must be comparable. Each partition is named after the Go
+// syntax representation of its params, in the form group(params), and this
+// name is used in errors, stats and the GroupCache.
+func (g *GroupState) FetchParams(group, key string, params any, resolver GroupResolveParamsFunc, opts ...GroupOption) (any, error) {
+	if params != nil && !reflect.TypeOf(params).Comparable() {
+		return nil, fmt.Errorf("json: params of group %s have non-comparable type %T", group, params)
+	}
+	ginfo := g.paramsGroup(group, params)
+	if !ginfo.hasResolver() {
+		ginfo.fn = func(ctx context.Context, keys []string) ([]any, error) {
+			return resolver(ctx, keys, params)
 		}
-		return nil, ErrRetryNeeded
+		ginfo.configure(opts)
+	}
+	return g.fetch(ginfo, key)
+}
+
+// groupParamsKey identifies the partition of a group for params.
+type groupParamsKey struct {
+	group  string
+	params any
+}
+
+// paramsGroup returns the info for the partition of group for params,
+// creating it if needed. Partitions whose names collide with another group
+// get a numbered suffix.
+func (g *GroupState) paramsGroup(group string, params any) *pendingGroupInfo {
+	k := groupParamsKey{group, params}
+	if ginfo, ok := g.params[k]; ok {
+		return ginfo
 	}
+	base := fmt.Sprintf("%s(%#v)", group, params)
+	name := base
+	for n := 2; g.data[name] != nil; n++ {
+		name = base + "#" + strconv.Itoa(n)
+	}
+	if g.params == nil {
+		g.params = make(map[groupParamsKey]*pendingGroupInfo)
+	}
+	ginfo := g.group(name)
+	g.params[k] = ginfo
+	return ginfo
+}
+
+// FetchAsync is like Fetch but uses an asynchronous resolver. At each
+// resolution round, the resolvers of all asynchronous groups are started
+// before waiting on any result, so that their work overlaps regardless of
+// ContextGroupConcurrency and GroupBatchConcurrency.
+func (g *GroupState) FetchAsync(group, key string, resolver GroupResolveAsyncFunc, opts ...GroupOption) (any, error) {
+	ginfo, err := g.ownGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	if !ginfo.hasResolver() {
+		ginfo.asyncFn = resolver
+		ginfo.configure(opts)
+	}
+	return g.fetch(ginfo, key)
+}
+
+// Seed stores value as the resolved value for key in group, so that fetching
+// it does not require a call to the resolver.
+func (g *GroupState) Seed(group, key string, value any) {
+	ginfo := g.group(group)
+	ginfo.resolved[key] = value
+	delete(ginfo.pending, key)
+	delete(ginfo.keyErr, key)
+}
+
+// group returns the info for group, creating it if needed.
+func (g *GroupState) group(group string) *pendingGroupInfo {
+	if ginfo, ok := g.data[group]; ok {
+		return ginfo
+	}
+	ginfo := &pendingGroupInfo{
+		name:     group,
+		st:       g,
+		pending:  make(map[string]bool),
+		resolved: make(map[string]any),
+		keyErr:   make(map[string]error),
+	}
+	g.data[group] = ginfo
+	return ginfo
+}
+
+func (g *pendingGroupInfo) hasResolver() bool {
+	return g.fn != nil || g.mapFn != nil || g.asyncFn != nil
+}
+
+func (g *pendingGroupInfo) configure(opts []GroupOption) {
+	for _, o := range opts {
+		o(&g.opts)
+	}
+}
+
+func (g *GroupState) fetch(ginfo *pendingGroupInfo, key string) (any, error) {
 	if v, ok := ginfo.resolved[key]; ok {
 		return v, nil
 	}
+	if err, ok := ginfo.keyErr[key]; ok {
+		return nil, &GroupError{Group: ginfo.name, Key: key, Err: err}
+	}
 	if ginfo.err != nil {
-		return nil, ginfo.err
+		return nil, &GroupError{Group: ginfo.name, Key: key, Err: ginfo.err}
+	}
+	if g.cache != nil {
+		if v, ok := g.cache.Get(ginfo.name, key); ok {
+			ginfo.resolved[key] = v
+			return v, nil
+		}
 	}
 	ginfo.pending[key] = true
 	return nil, ErrRetryNeeded
 }
 
-// resolve returns true if new stuff has been resolved
-func (g *pendingGroupInfo) resolve(ctx context.Context) bool {
-	if g.err != nil {
-		return false
+// takeBatches clears the pending keys of g and returns them split in batches
+// according to the options of the group.
+func (g *pendingGroupInfo) takeBatches() []*groupBatch {
+	if g.err != nil || len(g.pending) == 0 {
+		return nil
 	}
 	// generate list
 	pendinglst := make([]string, 0, len(g.pending))
 	for k := range g.pending {
 		pendinglst = append(pendinglst, k)
 	}
-	g.pending = make(map[string]bool) // TODO use clear(g.pending) with go1.21
-	vals, err := g.fn(ctx, pendinglst)
-	if err != nil {
-		g.err = err
-		return true
+	clear(g.pending)
+
+	size := g.opts.batchSize
+	if size <= 0 || size >= len(pendinglst) {
+		return []*groupBatch{{keys: pendinglst}}
+	}
+
+	// split keys in batches of at most size keys
+	slices.Sort(pendinglst)
+	batches := make([]*groupBatch, 0, (len(pendinglst)+size-1)/size)
+	for len(pendinglst) > 0 {
+		n := min(size, len(pendinglst))
+		batches = append(batches, &groupBatch{keys: pendinglst[:n:n]})
+		pendinglst = pendinglst[n:]
+	}
+	return batches
+}
+
+// start starts the resolution of pending keys if g has an asynchronous
+// resolver. The batches are completed by the next call to resolve.
+func (g *pendingGroupInfo) start(ctx context.Context) {
+	if g.asyncFn == nil {
+		return
+	}
+	obs := groupObserverFromContext(ctx)
+	g.inflight = g.takeBatches()
+	for _, b := range g.inflight {
+		g.startBatch(ctx, obs, b)
+	}
+}
+
+// resolve returns true if new stuff has been resolved
+func (g *pendingGroupInfo) resolve(ctx context.Context) bool {
+	batches := g.inflight
+	g.inflight = nil
+	if batches == nil {
+		batches = g.takeBatches()
 	}
-	if len(vals) == 0 {
+	if len(batches) == 0 {
 		return false
 	}
-	if len(vals) > len(pendinglst) {
-		// this is not good
-		panic("too many responses from group resolver")
+	obs := groupObserverFromContext(ctx)
+
+	if len(batches) == 1 {
+		g.callBatch(ctx, obs, batches[0])
+		g.storeBatch(ctx, obs, batches[0], false)
+		return true
+	}
+
+	if c := g.opts.batchConcurrency; c > 1 && g.asyncFn == nil {
+		sem := make(chan struct{}, c)
+		var wg sync.WaitGroup
+		for _, b := range batches {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				g.callBatch(ctx, obs, b)
+			}()
+		}
+		wg.Wait()
+	} else {
+		for _, b := range batches {
+			g.callBatch(ctx, obs, b)
+		}
 	}
-	for n, v := range vals {
-		g.resolved[pendinglst[n]] = v
+	for _, b := range batches {
+		g.storeBatch(ctx, obs, b, true)
 	}
 	return true
 }
 
+// groupBatch holds the keys passed to a single resolver call and its results.
+type groupBatch struct {
+	keys    []string
+	vals    map[string]any
+	keyErrs map[string]error
+	res     GroupResolveResult
+	started time.Time
+	future  GroupFuture
+}
+
+// startBatch calls the resolver for the keys of b. Asynchronous resolvers
+// only return a future, which callBatch waits on.
+func (g *pendingGroupInfo) startBatch(ctx context.Context, obs GroupObserver, b *groupBatch) {
+	if obs != nil {
+		obs.ResolverCall(ctx, g.name, b.keys)
+	}
+	b.started = time.Now()
+	if g.asyncFn != nil {
+		b.future, b.res.Err = g.callAsync(ctx, b.keys)
+		return
+	}
+	b.vals, b.keyErrs, b.res.Err = g.call(ctx, b.keys)
+}
+
+// callBatch completes the resolution of b, starting it if needed. It does
+// not modify g and can run concurrently with other calls.
+func (g *pendingGroupInfo) callBatch(ctx context.Context, obs GroupObserver, b *groupBatch) {
+	if b.started.IsZero() {
+		g.startBatch(ctx, obs, b)
+	}
+	if b.future != nil {
+		b.vals, b.res.Err = g.wait(ctx, b.future, b.keys)
+		b.future = nil
+	}
+	b.res.Keys = len(b.keys)
+	b.res.Duration = time.Since(b.started)
+}
+
+// storeBatch stores the results of b. If chunked is true, a resolver error
+// only fails the keys of b instead of the whole group.
+func (g *pendingGroupInfo) storeBatch(ctx context.Context, obs GroupObserver, b *groupBatch, chunked bool) {
+	res := &b.res
+	defer func() {
+		g.stat.add(*res)
+		if obs != nil {
+			obs.ResolverResult(ctx, g.name, *res)
+		}
+	}()
+
+	if res.Err != nil {
+		res.Failed = len(b.keys)
+		if !chunked {
+			g.err = res.Err
+			return
+		}
+		for _, k := range b.keys {
+			g.keyErr[k] = res.Err
+		}
+		return
+	}
+	// every pending key gets an outcome, so that the next round makes progress
+	for _, k := range b.keys {
+		if err, ok := b.keyErrs[k]; ok && err != nil {
+			g.keyErr[k] = err
+			res.Failed += 1
+			continue
+		}
+		v, ok := b.vals[k]
+		if !ok {
+			switch g.opts.missing {
+			case MissingKeyError:
+				g.keyErr[k] = ErrGroupKeyNotFound
+				res.Failed += 1
+				continue
+			case MissingKeyFallback:
+				v = g.opts.fallback
+			}
+		}
+		g.resolved[k] = v
+		res.Resolved += 1
+		if c := g.st.cache; c != nil {
+			c.Set(g.name, k, v, g.opts.cacheTTL)
+		}
+	}
+}
+
+// call runs the resolver of the group, turning panics and inconsistent
+// results into errors.
+func (g *pendingGroupInfo) call(ctx context.Context, keys []string) (vals map[string]any, keyErrs map[string]error, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("json: panic in resolver of group %s: %v", g.name, r)
+		}
+	}()
+
+	switch {
+	case g.mapFn != nil:
+		return g.mapFn(ctx, keys)
+	case g.fn != nil:
+		lst, err := g.fn(ctx, keys)
+		if err != nil {
+			return nil, nil, err
+		}
+		vals, err = g.byKey(keys, lst)
+		return vals, nil, err
+	default:
+		return nil, nil, fmt.Errorf("json: no resolver for group %s", g.name)
+	}
+}
+
+// callAsync starts the asynchronous resolver of the group, turning panics
+// into errors.
+func (g *pendingGroupInfo) callAsync(ctx context.Context, keys []string) (f GroupFuture, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("json: panic in resolver of group %s: %v", g.name, r)
+		}
+	}()
+
+	f = g.asyncFn(ctx, keys)
+	if f == nil {
+		return nil, fmt.Errorf("json: resolver of group %s returned a nil future", g.name)
+	}
+	return f, nil
+}
+
+// wait waits on a future returned by the asynchronous resolver of the group,
+// turning panics and inconsistent results into errors.
+func (g *pendingGroupInfo) wait(ctx context.Context, f GroupFuture, keys []string) (vals map[string]any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("json: panic in resolver of group %s: %v", g.name, r)
+		}
+	}()
+
+	lst, err := f.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return g.byKey(keys, lst)
+}
+
+// byKey indexes values returned in the same order as keys.
+func (g *pendingGroupInfo) byKey(keys []string, lst []any) (map[string]any, error) {
+	if len(lst) > len(keys) {
+		return nil, fmt.Errorf("json: resolver of group %s returned %d values for %d keys", g.name, len(lst), len(keys))
+	}
+	vals := make(map[string]any, len(lst))
+	for n, v := range lst {
+		vals[keys[n]] = v
+	}
+	return vals, nil
+}
+
 // internal encoding methods
+
+// groupHole records a value that could not be rendered before its groups are
+// resolved, and the position in the buffer its output belongs to.
+type groupHole struct {
+	pos    int
+	v      reflect.Value
+	enc    encoderFunc
+	opts   encOpts
+	fields *fieldSet
+}
+
+// deferGroup records v to be rendered with enc at the current position of the
+// buffer once pending groups have been resolved.
+func (e *encodeState) deferGroup(v reflect.Value, enc encoderFunc, opts encOpts) {
+	st, _ := e.groupState()
+	st.bumpRetry()
+	e.groupHoles = append(e.groupHoles, groupHole{pos: e.Len(), v: v, enc: enc, opts: opts, fields: e.fields})
+}
+
+// fillGroupHoles renders the values recorded by deferGroup and splices their
+// output into the buffer, which holds data from start onward. Values that
+// still cannot be rendered are recorded again.
+func (e *encodeState) fillGroupHoles(start int) {
+	holes := e.groupHoles
+	e.groupHoles = nil
+
+	tail := bytes.Clone(e.Bytes()[start:])
+	e.Truncate(start)
+	last := start
+	for _, h := range holes {
+		e.Write(tail[last-start : h.pos-start])
+		e.fields = h.fields
+		h.enc(e, h.v, h.opts)
+		last = h.pos
+	}
+	e.fields = e.ctxFields
+	e.Write(tail[last-start:])
+}
+
+// groupState returns the GroupState of the current encoding, creating it if
+// needed, and a context carrying it.
+func (e *encodeState) groupState() (*GroupState, context.Context) {
+	if e.groupSt == nil {
+		e.groupSt = newGroupState(e.groupCache)
+	} else if e.groupCache != nil && !e.groupNested {
+		e.groupSt.cache = e.groupCache
+	}
+	if r := groupRegistryFromContext(e.ctx); r != nil && !e.groupNested {
+		e.groupSt.registry = r
+	}
+	if e.groupCtx == nil {
+		e.groupCtx = context.WithValue(e.ctx, jsonOptionGroupState, e.groupSt)
+	}
+	return e.groupSt, e.groupCtx
+}
+
 func groupMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 	if v.Kind() == reflect.Pointer && v.IsNil() {
 		e.WriteString("null")
@@ -141,10 +814,12 @@ func groupMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		e.WriteString("null")
 		return
 	}
-	if e.groupSt == nil {
-		e.groupSt = newGroupState()
+	st, ctx := e.groupState()
+	b, err := m.GroupMarshalerJSON(e.withFields(ctx), st)
+	err = e.absorbPartial(err)
+	if err != nil && !errors.Is(err, ErrRetryNeeded) {
+		b, err = e.groupDegrade(m, err)
 	}
-	b, err := m.GroupMarshalerJSON(e.ctx, e.groupSt)
 	if err == nil {
 		e.Grow(len(b))
 		out := e.AvailableBuffer()
@@ -152,6 +827,10 @@ func groupMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		e.Buffer.Write(out)
 	}
 	if err != nil {
+		if errors.Is(err, ErrRetryNeeded) {
+			e.deferGroup(v, groupMarshalerEncoder, opts)
+			return
+		}
 		e.error(&MarshalerError{v.Type(), err, "MarshalJSON"})
 	}
 }
@@ -163,10 +842,12 @@ func addrGroupMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		return
 	}
 	m := va.Interface().(GroupMarshaler)
-	if e.groupSt == nil {
-		e.groupSt = newGroupState()
+	st, ctx := e.groupState()
+	b, err := m.GroupMarshalerJSON(e.withFields(ctx), st)
+	err = e.absorbPartial(err)
+	if err != nil && !errors.Is(err, ErrRetryNeeded) {
+		b, err = e.groupDegrade(m, err)
 	}
-	b, err := m.GroupMarshalerJSON(e.ctx, e.groupSt)
 	if err == nil {
 		e.Grow(len(b))
 		out := e.AvailableBuffer()
@@ -174,6 +855,167 @@ func addrGroupMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		e.Buffer.Write(out)
 	}
 	if err != nil {
+		if errors.Is(err, ErrRetryNeeded) {
+			e.deferGroup(v, addrGroupMarshalerEncoder, opts)
+			return
+		}
 		e.error(&MarshalerError{v.Type(), err, "MarshalJSON"})
 	}
 }
+
+// groupDegrade returns the output to use for a GroupMarshaler that failed with
+// err, according to the error policy of the group, or err if the encoding
+// should fail.
+func (e *encodeState) groupDegrade(m GroupMarshaler, err error) ([]byte, error) {
+	var gerr *GroupError
+	if !errors.As(err, &gerr) {
+		return nil, err
+	}
+	policy := groupErrorPolicy(e.ctx)
+	if ginfo, ok := e.groupSt.data[gerr.Group]; ok && ginfo.opts.onErrorSet {
+		policy = ginfo.opts.onError
+	}
+
+	b := []byte("null")
+	switch policy {
+	case GroupErrorFallback:
+		if mj, ok := m.(Marshaler); ok {
+			var ferr error
+			if b, ferr = mj.MarshalJSON(); ferr != nil {
+				return nil, err
+			}
+		}
+	case GroupErrorNull:
+	default:
+		return nil, err
+	}
+	e.groupSt.addFailure(gerr)
+	return b, nil
+}
+
+func (g *GroupState) addFailure(gerr *GroupError) {
+	for _, f := range g.failures {
+		if f.Group == gerr.Group && f.Key == gerr.Key {
+			return
+		}
+	}
+	g.failures = append(g.failures, gerr)
+}
+
+// absorbPartial records in the current encoding the failures of a
+// GroupPartialError returned by a marshaler from a nested encoding, so that
+// its output is used and the failures are reported by the outer encoding.
+// Other errors are returned unchanged.
+func (e *encodeState) absorbPartial(err error) error {
+	perr, ok := err.(*GroupPartialError)
+	if !ok {
+		return err
+	}
+	st, _ := e.groupState()
+	for _, gerr := range perr.Errors {
+		st.addFailure(gerr)
+	}
+	return nil
+}
+
+// partialError returns a GroupPartialError if values were rendered in a
+// degraded form.
+func (g *GroupState) partialError() error {
+	if g == nil || len(g.failures) == 0 {
+		return nil
+	}
+	return &GroupPartialError{Errors: slices.Clone(g.failures)}
+}
+
+// internal decoding methods
+
+// groupDeferred records a GroupUnmarshaler waiting for group resolution, with
+// its location in the document for error reporting.
+type groupDeferred struct {
+	u     GroupUnmarshaler
+	data  []byte
+	strct string
+	field string
+}
+
+func (d *decodeState) groupUnmarshal(u GroupUnmarshaler, data []byte) error {
+	if d.groupSt == nil {
+		d.groupSt = groupStateAttached(d.ctx)
+		if d.groupSt == nil {
+			d.groupSt = newGroupState(nil)
+		}
+		if c := groupCacheFromContext(d.ctx); c != nil {
+			d.groupSt.cache = c
+		}
+		if r := groupRegistryFromContext(d.ctx); r != nil {
+			d.groupSt.registry = r
+		}
+		d.groupSt.resetRun()
+	}
+	err := u.GroupUnmarshalerJSON(d.ctx, d.groupSt, data)
+	if !errors.Is(err, ErrRetryNeeded) {
+		return err
+	}
+	d.groupSt.bumpRetry()
+	p := groupDeferred{u: u, data: data}
+	if d.errorContext != nil {
+		if d.errorContext.Struct != nil {
+			p.strct = d.errorContext.Struct.Name()
+		}
+		p.field = strings.Join(d.errorContext.FieldStack, ".")
+	}
+	d.groupPending = append(d.groupPending, p)
+	return nil
+}
+
+// groupStore records a value holding deferred GroupUnmarshalers that was
+// copied by its container before its groups were resolved, such as a slice
+// element before the slice grew or a map value. The copy is stored again once
+// the groups are resolved.
+type groupStore struct {
+	m   reflect.Value // map holding the value, if any
+	key reflect.Value // key of the value in m
+	dst reflect.Value // location of the value, if not in a map
+	src reflect.Value // value the deferred GroupUnmarshalers point into
+}
+
+func (s groupStore) store() {
+	if s.m.IsValid() {
+		s.m.SetMapIndex(s.key, s.src)
+		return
+	}
+	s.dst.Set(s.src)
+}
+
+// resolveGroups resolves the groups needed by values deferred during decoding
+// and calls them again until all of them are done, then stores the values
+// moved by their container.
+func (d *decodeState) resolveGroups() error {
+	for len(d.groupPending) > 0 {
+		retry, err := d.groupSt.retry(d.ctx)
+		if err != nil {
+			return err
+		}
+		pending := d.groupPending
+		d.groupPending = nil
+		for _, p := range pending {
+			err := ErrRetryNeeded
+			if retry {
+				err = p.u.GroupUnmarshalerJSON(d.ctx, d.groupSt, p.data)
+			}
+			switch {
+			case err == nil:
+			case retry && errors.Is(err, ErrRetryNeeded):
+				d.groupSt.bumpRetry()
+				d.groupPending = append(d.groupPending, p)
+			default:
+				return &GroupUnmarshalError{Struct: p.strct, Field: p.field, Err: err}
+			}
+		}
+	}
+	for _, s := range d.groupStores {
+		s.store()
+	}
+	d.groupStores = nil
+	return nil
+}
@@ -0,0 +1,155 @@
+package pjson
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// GroupCache is the interface implemented by caches storing values resolved
+// by GroupState across encodings. A cache can be attached to an encoding using
+// ContextGroupCache or Encoder.SetGroupCache. Implementations must be safe for
+// concurrent use, as resolvers of different groups may run in parallel.
+type GroupCache interface {
+	// Get returns the cached value for key in group, if any.
+	Get(group, key string) (any, bool)
+	// Set stores a resolved value. A ttl of zero means the cache default.
+	Set(group, key string, v any, ttl time.Duration)
+	// Invalidate removes the given keys of group, or the whole group if no
+	// key is given.
+	Invalidate(group string, keys ...string)
+}
+
+// GroupLRU is a bounded in-memory GroupCache evicting the least recently used
+// values first.
+type GroupLRU struct {
+	lk      sync.Mutex
+	size    int
+	ttl     time.Duration
+	ttls    map[string]time.Duration
+	entries map[groupLRUKey]*list.Element
+	order   *list.List // front is most recently used
+}
+
+type groupLRUKey struct {
+	group, key string
+}
+
+type groupLRUEntry struct {
+	k       groupLRUKey
+	v       any
+	expires time.Time // zero if the entry does not expire
+}
+
+var _ GroupCache = (*GroupLRU)(nil)
+
+// NewGroupLRU returns a GroupLRU holding at most size values, which expire
+// after ttl unless another TTL is set for their group. A ttl of zero means
+// values do not expire.
+func NewGroupLRU(size int, ttl time.Duration) *GroupLRU {
+	return &GroupLRU{
+		size:    size,
+		ttl:     ttl,
+		ttls:    make(map[string]time.Duration),
+		entries: make(map[groupLRUKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// SetTTL sets the default TTL for values of group. A negative ttl means values
+// of group never expire.
+func (c *GroupLRU) SetTTL(group string, ttl time.Duration) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.ttls[group] = ttl
+}
+
+// Get implements GroupCache.
+func (c *GroupLRU) Get(group, key string) (any, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	el, ok := c.entries[groupLRUKey{group, key}]
+	if !ok {
+		return nil, false
+	}
+	ent := el.Value.(*groupLRUEntry)
+	if !ent.expires.IsZero() && time.Now().After(ent.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return ent.v, true
+}
+
+// Set implements GroupCache.
+func (c *GroupLRU) Set(group, key string, v any, ttl time.Duration) {
+	if ttl == 0 {
+		ttl = c.groupTTL(group)
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	k := groupLRUKey{group, key}
+	if el, ok := c.entries[k]; ok {
+		ent := el.Value.(*groupLRUEntry)
+		ent.v = v
+		ent.expires = expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[k] = c.order.PushFront(&groupLRUEntry{k: k, v: v, expires: expires})
+	for c.size > 0 && c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Invalidate implements GroupCache.
+func (c *GroupLRU) Invalidate(group string, keys ...string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if len(keys) == 0 {
+		for k, el := range c.entries {
+			if k.group == group {
+				c.remove(el)
+			}
+		}
+		return
+	}
+	for _, key := range keys {
+		if el, ok := c.entries[groupLRUKey{group, key}]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// Len returns the number of values currently held by the cache, including
+// expired values not yet evicted.
+func (c *GroupLRU) Len() int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *GroupLRU) groupTTL(group string) time.Duration {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if ttl, ok := c.ttls[group]; ok {
+		return ttl
+	}
+	return c.ttl
+}
+
+func (c *GroupLRU) remove(el *list.Element) {
+	ent := c.order.Remove(el).(*groupLRUEntry)
+	delete(c.entries, ent.k)
+}
@@ -0,0 +1,95 @@
+package pjson_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/pjson"
+)
+
+func TestGroupLRU(t *testing.T) {
+	c := pjson.NewGroupLRU(2, 0)
+	c.Set("users", "a", 1, 0)
+	c.Set("users", "b", 2, 0)
+	if _, ok := c.Get("users", "a"); !ok {
+		t.Errorf("expected users/a to be cached")
+	}
+	// a was used more recently than b, so b gets evicted
+	c.Set("orgs", "a", 3, 0)
+	if _, ok := c.Get("users", "b"); ok {
+		t.Errorf("expected users/b to be evicted")
+	}
+	if v, ok := c.Get("orgs", "a"); !ok || v != 3 {
+		t.Errorf("unexpected value for orgs/a: %v", v)
+	}
+
+	c.Invalidate("users")
+	if _, ok := c.Get("users", "a"); ok {
+		t.Errorf("expected users/a to be invalidated")
+	}
+	c.Invalidate("orgs", "a")
+	if c.Len() != 0 {
+		t.Errorf("expected empty cache, got %d values", c.Len())
+	}
+
+	c.SetTTL("short", time.Millisecond)
+	c.Set("short", "a", 1, 0)
+	c.Set("users", "a", 1, 0)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get("short", "a"); ok {
+		t.Errorf("expected short/a to be expired")
+	}
+	if _, ok := c.Get("users", "a"); !ok {
+		t.Errorf("expected users/a to still be cached")
+	}
+}
+
+func TestGroupCache(t *testing.T) {
+	var calls [][]string
+	resolver := func(ctx context.Context, keys []string) ([]any, error) {
+		calls = append(calls, keys)
+		return resolverA(ctx, keys)
+	}
+
+	c := pjson.NewGroupLRU(100, time.Minute)
+	ctx := pjson.ContextGroupCache(context.Background(), c)
+
+	for _, tst := range []struct {
+		keys   []string
+		expect string
+		called []string
+	}{
+		{[]string{"foo"}, `["FOO"]`, []string{"foo"}},
+		{[]string{"foo", "bar"}, `["FOO","BAR"]`, []string{"bar"}},
+		{[]string{"bar", "foo"}, `["BAR","FOO"]`, nil},
+	} {
+		calls = nil
+		var v []any
+		for _, k := range tst.keys {
+			v = append(v, pjson.GroupCall("cached", k, resolver))
+		}
+		res, err := pjson.MarshalContext(ctx, v)
+		if err != nil {
+			t.Fatalf("failed to marshal: %s", err)
+		}
+		if string(res) != tst.expect {
+			t.Errorf("unexpected result, expected %s but got %s", tst.expect, res)
+		}
+		switch {
+		case tst.called == nil && len(calls) != 0:
+			t.Errorf("expected no resolver call, got %v", calls)
+		case tst.called != nil && (len(calls) != 1 || len(calls[0]) != len(tst.called) || calls[0][0] != tst.called[0]):
+			t.Errorf("expected resolver call with %v, got %v", tst.called, calls)
+		}
+	}
+
+	c.Invalidate("cached", "foo")
+	calls = nil
+	if _, err := pjson.MarshalContext(ctx, pjson.GroupCall("cached", "foo", resolver)); err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if len(calls) != 1 {
+		t.Errorf("expected resolver to be called after invalidation, got %v", calls)
+	}
+}
@@ -0,0 +1,96 @@
+package pjson
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// FetchAs is a typed variant of GroupState.Fetch accepting any comparable key
+// type. Keys are converted to strings for the bookkeeping of st, using their
+// String method if they have one. Keys missing from the resolver results as
+// well as nil values are returned as the zero value of T.
+//
+// When FetchAs configures a group, keys fetched from it with Fetch are only
+// resolved if K is a string type; otherwise they fail with a GroupError, since
+// they cannot be converted back to K.
+func FetchAs[T any, K comparable](st *GroupState, group string, key K, resolver func(context.Context, []K) (map[K]T, error), opts ...GroupOption) (T, error) {
+	var zero T
+	ks := groupKeyString(key)
+
+	ginfo, err := st.ownGroup(group)
+	if err != nil {
+		return zero, err
+	}
+	if !ginfo.hasResolver() {
+		ginfo.configure(opts)
+		ginfo.keys = make(map[string]any)
+		ginfo.mapFn = func(ctx context.Context, keys []string) (map[string]any, map[string]error, error) {
+			lst := make([]K, 0, len(keys))
+			var keyErrs map[string]error
+			for _, k := range keys {
+				if kv, ok := ginfo.keys[k].(K); ok {
+					lst = append(lst, kv)
+				} else if kv, ok := any(k).(K); ok {
+					lst = append(lst, kv)
+				} else {
+					if keyErrs == nil {
+						keyErrs = make(map[string]error)
+					}
+					keyErrs[k] = fmt.Errorf("json: key %s of group %s was not fetched with FetchAs and cannot be converted to %T", k, group, kv)
+				}
+			}
+			if len(lst) == 0 {
+				return nil, keyErrs, nil
+			}
+			res, err := resolver(ctx, lst)
+			if err != nil {
+				return nil, nil, err
+			}
+			vals := make(map[string]any, len(res))
+			for k, v := range res {
+				vals[groupKeyString(k)] = v
+			}
+			return vals, keyErrs, nil
+		}
+	}
+	if ginfo.keys != nil {
+		if _, ok := ginfo.keys[ks]; !ok {
+			ginfo.keys[ks] = key
+		}
+	}
+
+	v, err := st.fetch(ginfo, ks)
+	if err != nil || v == nil {
+		return zero, err
+	}
+	res, ok := v.(T)
+	if !ok {
+		return zero, fmt.Errorf("json: value for key %s of group %s has type %T, expected %T", ks, group, v, zero)
+	}
+	return res, nil
+}
+
+// groupKeyString returns the string form of a key used by GroupState.
+func groupKeyString(k any) string {
+	switch k := k.(type) {
+	case string:
+		return k
+	case fmt.Stringer:
+		return k.String()
+	case int:
+		return strconv.Itoa(k)
+	case int64:
+		return strconv.FormatInt(k, 10)
+	case int32:
+		return strconv.FormatInt(int64(k), 10)
+	case uint:
+		return strconv.FormatUint(uint64(k), 10)
+	case uint64:
+		return strconv.FormatUint(k, 10)
+	case uint32:
+		return strconv.FormatUint(uint64(k), 10)
+	default:
+		return fmt.Sprint(k)
+	}
+}
@@ -0,0 +1,67 @@
+package pjson
+
+import (
+	"context"
+	"time"
+)
+
+// GroupObserver is the interface implemented by types receiving events about
+// group resolution, for example to export metrics or tracing spans. An
+// observer is attached to encodings and decodings using ContextGroupObserver.
+// ResolverCall and ResolverResult may be called concurrently when several
+// groups are resolved in parallel.
+type GroupObserver interface {
+	// RoundStart is called before each resolution round with the groups
+	// having keys pending.
+	RoundStart(ctx context.Context, round int, groups []string)
+	// ResolverCall is called before calling the resolver of group.
+	ResolverCall(ctx context.Context, group string, keys []string)
+	// ResolverResult is called after the resolver of group has returned.
+	ResolverResult(ctx context.Context, group string, res GroupResolveResult)
+}
+
+// GroupResolveResult describes the outcome of a single resolver call.
+type GroupResolveResult struct {
+	Keys     int           // number of keys passed to the resolver
+	Resolved int           // number of keys that got a value
+	Failed   int           // number of keys that got an error
+	Duration time.Duration // time spent in the resolver
+	Err      error         // error returned by the resolver, if any
+}
+
+// GroupStats is a snapshot of the resolution work done by a GroupState.
+type GroupStats struct {
+	Rounds int                  // number of resolution rounds
+	Groups map[string]GroupStat // statistics by group name
+}
+
+// GroupStat holds the resolution statistics of a single group.
+type GroupStat struct {
+	Calls    int           // number of resolver calls
+	Errors   int           // number of resolver calls that returned an error
+	Keys     int           // number of keys passed to the resolver
+	Resolved int           // number of keys that got a value
+	Failed   int           // number of keys that got an error
+	Duration time.Duration // total time spent in the resolver
+}
+
+func (s *GroupStat) add(res GroupResolveResult) {
+	s.Calls += 1
+	if res.Err != nil {
+		s.Errors += 1
+	}
+	s.Keys += res.Keys
+	s.Resolved += res.Resolved
+	s.Failed += res.Failed
+	s.Duration += res.Duration
+}
+
+// Stats returns a snapshot of the resolution work done by the state. It must
+// not be called while a resolution round is running.
+func (g *GroupState) Stats() GroupStats {
+	res := GroupStats{Rounds: g.totalRounds, Groups: make(map[string]GroupStat, len(g.data))}
+	for name, ginfo := range g.data {
+		res.Groups[name] = ginfo.stat
+	}
+	return res
+}
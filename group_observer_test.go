@@ -0,0 +1,74 @@
+package pjson_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/KarpelesLab/pjson"
+)
+
+type testObserver struct {
+	lk     sync.Mutex
+	events []string
+}
+
+func (o *testObserver) RoundStart(ctx context.Context, round int, groups []string) {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	o.events = append(o.events, fmt.Sprintf("round %d %v", round, groups))
+}
+
+func (o *testObserver) ResolverCall(ctx context.Context, group string, keys []string) {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	o.events = append(o.events, fmt.Sprintf("call %s %d", group, len(keys)))
+}
+
+func (o *testObserver) ResolverResult(ctx context.Context, group string, res pjson.GroupResolveResult) {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	o.events = append(o.events, fmt.Sprintf("result %s %d/%d", group, res.Resolved, res.Keys))
+}
+
+func TestGroupObserver(t *testing.T) {
+	obs := &testObserver{}
+	st := pjson.NewGroupState()
+	ctx := pjson.ContextGroupObserver(context.Background(), obs)
+	ctx = pjson.ContextGroupState(ctx, st)
+
+	tst := []any{
+		&objectD{key: "x"},
+		&objectD{key: "y"},
+		pjson.GroupCall("observed", "z", resolverA),
+	}
+	if _, err := pjson.MarshalContext(ctx, tst); err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+
+	// resolvers of a round run concurrently, sort events within rounds
+	sort.Strings(obs.events[1:5])
+	expect := []string{
+		"round 1 [observed resolverD]",
+		"call observed 1",
+		"call resolverD 2",
+		"result observed 1/1",
+		"result resolverD 2/2",
+		"round 2 [resolverA]",
+		"call resolverA 2",
+		"result resolverA 2/2",
+	}
+	if fmt.Sprint(obs.events) != fmt.Sprint(expect) {
+		t.Errorf("unexpected events:\n%v\nexpected:\n%v", obs.events, expect)
+	}
+
+	stats := st.Stats()
+	if stats.Rounds != 2 || len(stats.Groups) != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if s := stats.Groups["resolverD"]; s.Calls != 1 || s.Keys != 2 || s.Resolved != 2 || s.Failed != 0 {
+		t.Errorf("unexpected stats for resolverD: %+v", s)
+	}
+}
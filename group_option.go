@@ -0,0 +1,78 @@
+package pjson
+
+import "time"
+
+// GroupOption configures a group the first time it is seen by a GroupState.
+type GroupOption func(*groupOptions)
+
+type groupOptions struct {
+	missing    MissingKeyPolicy
+	fallback   any
+	onError    GroupErrorPolicy
+	onErrorSet bool
+
+	batchSize        int
+	batchConcurrency int
+	cacheTTL         time.Duration
+}
+
+// MissingKeyPolicy defines what happens to keys a resolver did not return a
+// value or an error for.
+type MissingKeyPolicy int
+
+const (
+	MissingKeyNull     MissingKeyPolicy = iota // missing keys resolve to nil (default)
+	MissingKeyError                            // missing keys fail with ErrGroupKeyNotFound
+	MissingKeyFallback                         // missing keys resolve to the value set by GroupFallback
+)
+
+// GroupMissingKey sets the policy applied to keys missing from the resolver
+// results.
+func GroupMissingKey(p MissingKeyPolicy) GroupOption {
+	return func(o *groupOptions) {
+		o.missing = p
+	}
+}
+
+// GroupFallback makes keys missing from the resolver results resolve to v.
+func GroupFallback(v any) GroupOption {
+	return func(o *groupOptions) {
+		o.missing = MissingKeyFallback
+		o.fallback = v
+	}
+}
+
+// GroupOnError sets the policy applied to values failing because of an error
+// in this group, overriding the policy set with ContextGroupErrorPolicy.
+func GroupOnError(p GroupErrorPolicy) GroupOption {
+	return func(o *groupOptions) {
+		o.onError = p
+		o.onErrorSet = true
+	}
+}
+
+// GroupBatchSize limits the number of keys passed to a single resolver call
+// to n. Pending keys exceeding this limit are split across several calls, and
+// a resolver error then only fails the keys of the failing call.
+func GroupBatchSize(n int) GroupOption {
+	return func(o *groupOptions) {
+		o.batchSize = n
+	}
+}
+
+// GroupBatchConcurrency allows up to n resolver calls of the group to run in
+// parallel when its keys are split by GroupBatchSize. By default calls are
+// made one after another.
+func GroupBatchConcurrency(n int) GroupOption {
+	return func(o *groupOptions) {
+		o.batchConcurrency = n
+	}
+}
+
+// GroupCacheTTL sets the TTL of values of the group stored in the GroupCache
+// of the encoding, overriding the default TTL of the cache.
+func GroupCacheTTL(ttl time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.cacheTTL = ttl
+	}
+}
@@ -0,0 +1,149 @@
+package pjson
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrGroupRegistered is returned when registering a group name that is
+	// already registered.
+	ErrGroupRegistered = errors.New("group already registered")
+	// ErrGroupNotRegistered is returned by FetchNamed for unknown groups.
+	ErrGroupNotRegistered = errors.New("group not registered")
+	// ErrGroupConflict is returned when a group is fetched both with
+	// FetchNamed and with a resolver passed by the caller.
+	ErrGroupConflict = errors.New("group resolver conflict")
+)
+
+// GroupRegistry holds named group resolvers along with their options, so
+// that values can fetch from a group by name only using GroupState.FetchNamed.
+type GroupRegistry struct {
+	lk     sync.RWMutex
+	groups map[string]*groupRegistration
+}
+
+type groupRegistration struct {
+	fn    GroupResolveFunc
+	mapFn GroupResolveMapFunc
+	opts  []GroupOption
+}
+
+// DefaultGroupRegistry is the registry used by RegisterGroup, and by
+// FetchNamed unless another registry is set with ContextGroupRegistry.
+var DefaultGroupRegistry = NewGroupRegistry()
+
+// NewGroupRegistry returns a new empty GroupRegistry.
+func NewGroupRegistry() *GroupRegistry {
+	return &GroupRegistry{groups: make(map[string]*groupRegistration)}
+}
+
+// Register registers resolver and opts for the group name. An error wrapping
+// ErrGroupRegistered is returned if name is already registered.
+func (r *GroupRegistry) Register(name string, resolver GroupResolveFunc, opts ...GroupOption) error {
+	return r.register(name, &groupRegistration{fn: resolver, opts: opts})
+}
+
+// RegisterMap is like Register for resolvers returning values indexed by key.
+func (r *GroupRegistry) RegisterMap(name string, resolver GroupResolveMapFunc, opts ...GroupOption) error {
+	return r.register(name, &groupRegistration{mapFn: resolver, opts: opts})
+}
+
+// Unregister removes the group name from the registry.
+func (r *GroupRegistry) Unregister(name string) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	delete(r.groups, name)
+}
+
+func (r *GroupRegistry) register(name string, reg *groupRegistration) error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	if _, ok := r.groups[name]; ok {
+		return fmt.Errorf("json: cannot register group %s: %w", name, ErrGroupRegistered)
+	}
+	r.groups[name] = reg
+	return nil
+}
+
+func (r *GroupRegistry) lookup(name string) (*groupRegistration, bool) {
+	r.lk.RLock()
+	defer r.lk.RUnlock()
+
+	reg, ok := r.groups[name]
+	return reg, ok
+}
+
+// RegisterGroup registers resolver and opts for the group name in
+// DefaultGroupRegistry.
+func RegisterGroup(name string, resolver GroupResolveFunc, opts ...GroupOption) error {
+	return DefaultGroupRegistry.Register(name, resolver, opts...)
+}
+
+// RegisterGroupMap registers a resolver returning values indexed by key for
+// the group name in DefaultGroupRegistry.
+func RegisterGroupMap(name string, resolver GroupResolveMapFunc, opts ...GroupOption) error {
+	return DefaultGroupRegistry.RegisterMap(name, resolver, opts...)
+}
+
+// ContextGroupRegistry returns a context making FetchNamed look up groups in
+// r instead of DefaultGroupRegistry.
+func ContextGroupRegistry(parent context.Context, r *GroupRegistry) context.Context {
+	return context.WithValue(parent, jsonOptionGroupRegistry, r)
+}
+
+func groupRegistryFromContext(ctx context.Context) *GroupRegistry {
+	r, _ := ctx.Value(jsonOptionGroupRegistry).(*GroupRegistry)
+	return r
+}
+
+// FetchNamed is like Fetch for a group registered in the registry of the
+// encoding, using the resolver and options it was registered with. An error
+// wrapping ErrGroupConflict is returned if the group was already fetched with
+// a resolver passed by the caller.
+func (g *GroupState) FetchNamed(group, key string) (any, error) {
+	ginfo, ok := g.data[group]
+	if ok && ginfo.hasResolver() && !ginfo.named {
+		return nil, fmt.Errorf("json: group %s was fetched with its own resolver and cannot be fetched with FetchNamed: %w", group, ErrGroupConflict)
+	}
+	if !ok || !ginfo.hasResolver() {
+		reg, ok := g.lookupRegistry(group)
+		if !ok {
+			return nil, fmt.Errorf("json: cannot fetch from group %s: %w", group, ErrGroupNotRegistered)
+		}
+		ginfo = g.group(group)
+		ginfo.named = true
+		ginfo.fn = reg.fn
+		ginfo.mapFn = reg.mapFn
+		ginfo.configure(reg.opts)
+	}
+	return g.fetch(ginfo, key)
+}
+
+// lookupRegistry returns the registration of group in the registry of g.
+func (g *GroupState) lookupRegistry(group string) (*groupRegistration, bool) {
+	r := g.registry
+	if r == nil {
+		r = DefaultGroupRegistry
+	}
+	return r.lookup(group)
+}
+
+// ownGroup returns the info for group when fetched with a resolver passed by
+// the caller. An error wrapping ErrGroupConflict is returned if the group is
+// registered, so that registered resolvers are never silently replaced.
+func (g *GroupState) ownGroup(group string) (*pendingGroupInfo, error) {
+	ginfo, ok := g.data[group]
+	registered := ok && ginfo.named
+	if !ok || !ginfo.hasResolver() {
+		_, registered = g.lookupRegistry(group)
+	}
+	if registered {
+		return nil, fmt.Errorf("json: group %s is registered and must be fetched with FetchNamed: %w", group, ErrGroupConflict)
+	}
+	return g.group(group), nil
+}
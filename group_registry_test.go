@@ -0,0 +1,94 @@
+package pjson_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KarpelesLab/pjson"
+)
+
+type namedRef struct {
+	group string
+	key   string
+}
+
+func (n *namedRef) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	v, err := st.FetchNamed(n.group, n.key)
+	if err != nil {
+		return nil, err
+	}
+	return pjson.MarshalContext(ctx, v)
+}
+
+func TestGroupRegistry(t *testing.T) {
+	r := pjson.NewGroupRegistry()
+	if err := r.Register("upper", resolverA, pjson.GroupBatchSize(1)); err != nil {
+		t.Fatalf("failed to register: %s", err)
+	}
+	if err := r.Register("upper", resolverA); !errors.Is(err, pjson.ErrGroupRegistered) {
+		t.Errorf("expected ErrGroupRegistered, got %v", err)
+	}
+
+	st := pjson.NewGroupState()
+	ctx := pjson.ContextGroupRegistry(context.Background(), r)
+	ctx = pjson.ContextGroupState(ctx, st)
+
+	res, err := pjson.MarshalContext(ctx, []any{&namedRef{"upper", "a"}, &namedRef{"upper", "b"}})
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if string(res) != `["A","B"]` {
+		t.Errorf(`unexpected result, expected ["A","B"] but got %s`, res)
+	}
+	if s := st.Stats().Groups["upper"]; s.Calls != 2 {
+		t.Errorf("expected 2 resolver calls with a batch size of 1, got %d", s.Calls)
+	}
+
+	// groups are not registered in the default registry
+	_, err = pjson.Marshal(&namedRef{"upper", "a"})
+	if !errors.Is(err, pjson.ErrGroupNotRegistered) {
+		t.Errorf("expected ErrGroupNotRegistered, got %v", err)
+	}
+
+	// registered groups cannot be fetched with another resolver, in any order
+	ctx = pjson.ContextGroupRegistry(context.Background(), r)
+	for _, obj := range [][]any{
+		{&namedRef{"upper", "a"}, pjson.GroupCall("upper", "b", resolverA)},
+		{pjson.GroupCall("upper", "b", resolverA), &namedRef{"upper", "a"}},
+	} {
+		if _, err := pjson.MarshalContext(ctx, obj); !errors.Is(err, pjson.ErrGroupConflict) {
+			t.Errorf("expected ErrGroupConflict, got %v", err)
+		}
+	}
+
+	// groups fetched with their own resolver cannot be fetched with FetchNamed
+	st = pjson.NewGroupState()
+	st.Fetch("own", "a", resolverA)
+	r.Register("own", resolverA)
+	if _, err := st.FetchNamed("own", "a"); !errors.Is(err, pjson.ErrGroupConflict) {
+		t.Errorf("expected ErrGroupConflict, got %v", err)
+	}
+}
+
+func TestGroupRegistryCacheTTL(t *testing.T) {
+	r := pjson.NewGroupRegistry()
+	r.Register("short", resolverA, pjson.GroupCacheTTL(time.Millisecond))
+	r.Register("long", resolverA)
+
+	c := pjson.NewGroupLRU(10, time.Hour)
+	ctx := pjson.ContextGroupRegistry(context.Background(), r)
+	ctx = pjson.ContextGroupCache(ctx, c)
+
+	if _, err := pjson.MarshalContext(ctx, []any{&namedRef{"short", "a"}, &namedRef{"long", "a"}}); err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get("short", "a"); ok {
+		t.Errorf("expected short/a to be expired")
+	}
+	if _, ok := c.Get("long", "a"); !ok {
+		t.Errorf("expected long/a to be cached")
+	}
+}
@@ -2,8 +2,13 @@ package pjson_test
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/KarpelesLab/pjson"
 )
@@ -70,3 +75,912 @@ func TestGroups(t *testing.T) {
 		t.Errorf(`unexpected result - expected {"A":["FOO","not foo"],"B":{"a":"b","key":"TEST","z":"x"},"C":"hello","D":"WORLD","E":"KEYVAL"} but got: %s`, res)
 	}
 }
+
+type objectC struct {
+	group string
+	key   string
+}
+
+func (o *objectC) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	v, err := st.Fetch(o.group, o.key, resolverC)
+	if err != nil {
+		return nil, err
+	}
+	return pjson.MarshalContext(ctx, v)
+}
+
+var (
+	resolverCLock    sync.Mutex
+	resolverCRunning int
+	resolverCMax     int
+	resolverCBarrier chan struct{} // closed once resolverCWait resolvers are running
+	resolverCWait    int
+)
+
+func resolverC(ctx context.Context, keys []string) ([]any, error) {
+	resolverCLock.Lock()
+	resolverCRunning += 1
+	if resolverCRunning > resolverCMax {
+		resolverCMax = resolverCRunning
+	}
+	barrier := resolverCBarrier
+	if barrier != nil && resolverCRunning == resolverCWait {
+		close(barrier)
+	}
+	resolverCLock.Unlock()
+
+	if barrier != nil {
+		// wait for the other resolvers of the round to be running
+		select {
+		case <-barrier:
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	resolverCLock.Lock()
+	resolverCRunning -= 1
+	resolverCLock.Unlock()
+
+	return resolverA(ctx, keys)
+}
+
+func TestGroupsConcurrent(t *testing.T) {
+	tst := []*objectC{
+		&objectC{group: "users", key: "u1"},
+		&objectC{group: "orgs", key: "o1"},
+		&objectC{group: "files", key: "f1"},
+		&objectC{group: "users", key: "u2"},
+	}
+	expect := `["U1","O1","F1","U2"]`
+
+	for _, limit := range []int{0, 1} {
+		resolverCMax = 0
+		resolverCBarrier = nil
+		if limit == 0 {
+			resolverCBarrier = make(chan struct{})
+			resolverCWait = 3
+		}
+		ctx := pjson.ContextGroupConcurrency(context.Background(), limit)
+		res, err := pjson.MarshalContext(ctx, tst)
+		if err != nil {
+			t.Fatalf("failed to marshal: %s", err)
+		}
+		if string(res) != expect {
+			t.Errorf("unexpected result, expected %s but got %s", expect, res)
+		}
+		switch limit {
+		case 0:
+			if resolverCMax != 3 {
+				t.Errorf("expected 3 resolvers running concurrently, got %d", resolverCMax)
+			}
+		case 1:
+			if resolverCMax != 1 {
+				t.Errorf("expected resolvers to run one at a time, got %d", resolverCMax)
+			}
+		}
+	}
+}
+
+type objectD struct {
+	key string
+}
+
+func (o *objectD) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	v, err := st.Fetch("resolverD", o.key, resolverD)
+	if err != nil {
+		return nil, err
+	}
+	return pjson.MarshalContext(ctx, v)
+}
+
+var resolverDCalls [][]string
+
+func resolverD(ctx context.Context, keys []string) ([]any, error) {
+	resolverDCalls = append(resolverDCalls, keys)
+	res := make([]any, len(keys))
+
+	for n, k := range keys {
+		// each resolved value references an objectA
+		res[n] = map[string]any{"id": k, "a": &objectA{key: k + "-a"}}
+	}
+	return res, nil
+}
+
+func TestGroupsNested(t *testing.T) {
+	resolverDCalls = nil
+	var resolverACalls int
+	ctx := context.Background()
+
+	tst := []any{
+		&objectD{key: "x"},
+		&objectD{key: "y"},
+		pjson.GroupCall("countA", "z", func(ctx context.Context, keys []string) ([]any, error) {
+			resolverACalls += 1
+			res := make([]any, len(keys))
+			for n, k := range keys {
+				res[n] = &objectA{key: k}
+			}
+			return res, nil
+		}),
+	}
+
+	res, err := pjson.MarshalContext(ctx, tst)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	expect := `[{"a":"X-A","id":"x"},{"a":"Y-A","id":"y"},"Z"]`
+	if string(res) != expect {
+		t.Errorf("unexpected result, expected %s but got %s", expect, res)
+	}
+	if len(resolverDCalls) != 1 || len(resolverDCalls[0]) != 2 {
+		t.Errorf("expected a single call to resolverD with 2 keys, got %v", resolverDCalls)
+	}
+	if resolverACalls != 1 {
+		t.Errorf("expected a single call to countA resolver, got %d", resolverACalls)
+	}
+}
+
+type objectE struct {
+	key  string
+	opts []pjson.GroupOption
+}
+
+func (o *objectE) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	v, err := st.FetchMap("resolverE", o.key, resolverE, o.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return pjson.MarshalContext(ctx, v)
+}
+
+func resolverE(ctx context.Context, keys []string) (map[string]any, map[string]error, error) {
+	res := make(map[string]any)
+	errs := make(map[string]error)
+
+	for _, k := range keys {
+		switch {
+		case strings.HasPrefix(k, "missing"):
+		case strings.HasPrefix(k, "fail"):
+			errs[k] = errors.New("lookup failed")
+		default:
+			res[k] = strings.ToUpper(k)
+		}
+	}
+	return res, errs, nil
+}
+
+func TestGroupsMap(t *testing.T) {
+	tst := []*objectE{{key: "foo"}, {key: "missing"}, {key: "bar"}}
+	res, err := pjson.Marshal(tst)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if string(res) != `["FOO",null,"BAR"]` {
+		t.Errorf(`unexpected result, expected ["FOO",null,"BAR"] but got %s`, res)
+	}
+
+	tst = []*objectE{{key: "foo", opts: []pjson.GroupOption{pjson.GroupFallback("?")}}, {key: "missing"}}
+	res, err = pjson.Marshal(tst)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if string(res) != `["FOO","?"]` {
+		t.Errorf(`unexpected result, expected ["FOO","?"] but got %s`, res)
+	}
+
+	tst = []*objectE{{key: "missing", opts: []pjson.GroupOption{pjson.GroupMissingKey(pjson.MissingKeyError)}}}
+	_, err = pjson.Marshal(tst)
+	if !errors.Is(err, pjson.ErrGroupKeyNotFound) {
+		t.Errorf("expected ErrGroupKeyNotFound, got %v", err)
+	}
+
+	_, err = pjson.Marshal([]*objectE{{key: "foo"}, {key: "fail"}})
+	if err == nil || !strings.Contains(err.Error(), "lookup failed") {
+		t.Errorf("expected lookup failed error, got %v", err)
+	}
+}
+
+func TestGroupsResolverMisbehave(t *testing.T) {
+	tooMany := func(ctx context.Context, keys []string) ([]any, error) {
+		return make([]any, len(keys)+1), nil
+	}
+	tooFew := func(ctx context.Context, keys []string) ([]any, error) {
+		return nil, nil
+	}
+	panicking := func(ctx context.Context, keys []string) ([]any, error) {
+		panic("oops")
+	}
+
+	if _, err := pjson.Marshal(pjson.GroupCall("tooMany", "a", tooMany)); err == nil {
+		t.Errorf("expected error for resolver returning too many values")
+	}
+	if _, err := pjson.Marshal(pjson.GroupCall("panic", "a", panicking)); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("expected error for panicking resolver, got %v", err)
+	}
+	res, err := pjson.Marshal([]any{pjson.GroupCall("tooFew", "a", tooFew), pjson.GroupCall("tooFew", "b", tooFew)})
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if string(res) != `[null,null]` {
+		t.Errorf("unexpected result, expected [null,null] but got %s", res)
+	}
+}
+
+type typedUser struct {
+	ID   int64
+	Name string
+}
+
+type objectF struct {
+	id int64
+}
+
+func (o *objectF) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	u, err := pjson.FetchAs(st, "typedUsers", o.id, resolverF)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return []byte("null"), nil
+	}
+	return pjson.MarshalContext(ctx, u.Name)
+}
+
+var resolverFCalls [][]int64
+
+func resolverF(ctx context.Context, ids []int64) (map[int64]*typedUser, error) {
+	resolverFCalls = append(resolverFCalls, ids)
+	res := make(map[int64]*typedUser)
+	for _, id := range ids {
+		if id > 0 {
+			res[id] = &typedUser{ID: id, Name: "user" + strconv.FormatInt(id, 10)}
+		}
+	}
+	return res, nil
+}
+
+func TestGroupsTyped(t *testing.T) {
+	resolverFCalls = nil
+	tst := []*objectF{{id: 1}, {id: 42}, {id: -1}, {id: 1}}
+
+	res, err := pjson.Marshal(tst)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if string(res) != `["user1","user42",null,"user1"]` {
+		t.Errorf(`unexpected result, expected ["user1","user42",null,"user1"] but got %s`, res)
+	}
+	if len(resolverFCalls) != 1 || len(resolverFCalls[0]) != 3 {
+		t.Errorf("expected a single resolver call with 3 ids, got %v", resolverFCalls)
+	}
+
+	// keys fetched with Fetch cannot be converted to int64 keys
+	resolverFCalls = nil
+	res, err = pjson.Marshal([]any{&objectF{id: 1}, pjson.GroupCall("typedUsers", "2", resolverA)})
+	var gerr *pjson.GroupError
+	if !errors.As(err, &gerr) || gerr.Key != "2" {
+		t.Errorf("expected GroupError for key 2, got %s, %v", res, err)
+	}
+	if len(resolverFCalls) != 1 || !slices.Equal(resolverFCalls[0], []int64{1}) {
+		t.Errorf("expected a single resolver call with id 1, got %v", resolverFCalls)
+	}
+}
+
+type objectTree struct {
+	key string
+}
+
+func (o *objectTree) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	v, err := st.Fetch("tree", o.key, resolverTree)
+	if err != nil {
+		return nil, err
+	}
+	return pjson.MarshalContext(ctx, v)
+}
+
+// resolverTree returns nodes that always reference a child node
+func resolverTree(ctx context.Context, keys []string) ([]any, error) {
+	res := make([]any, len(keys))
+	for n, k := range keys {
+		res[n] = map[string]any{"child": &objectTree{key: k + "/c"}}
+	}
+	return res, nil
+}
+
+func TestGroupsMaxRounds(t *testing.T) {
+	ctx := pjson.ContextGroupMaxRounds(context.Background(), 5)
+	_, err := pjson.MarshalContext(ctx, &objectTree{key: "root"})
+	var roundsErr *pjson.GroupRoundsExceededError
+	if !errors.As(err, &roundsErr) {
+		t.Fatalf("expected GroupRoundsExceededError, got %v", err)
+	}
+	if roundsErr.Rounds != 5 || len(roundsErr.Pending) != 1 || roundsErr.Pending[0] != "tree" {
+		t.Errorf("unexpected error content: %+v", roundsErr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = pjson.MarshalContext(ctx, &objectTree{key: "root"})
+	if !errors.As(err, &roundsErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected GroupRoundsExceededError wrapping context.Canceled, got %v", err)
+	}
+}
+
+type countingMarshaler struct {
+	calls *int
+}
+
+func (c countingMarshaler) MarshalJSON() ([]byte, error) {
+	*c.calls += 1
+	return []byte(`"static"`), nil
+}
+
+func TestGroupsSplice(t *testing.T) {
+	var calls int
+	tst := &objectB{
+		A: []any{countingMarshaler{&calls}, &objectD{key: "a"}},
+		B: map[string]any{"x": &objectA{key: "x"}, "y": countingMarshaler{&calls}},
+		C: countingMarshaler{&calls},
+		D: &objectD{key: "d"},
+	}
+
+	res, err := pjson.Marshal(tst)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	expect := `{"A":["static",{"a":"A-A","id":"a"}],"B":{"x":"X","y":"static"},"C":"static","D":{"a":"D-A","id":"d"},"E":null}`
+	if string(res) != expect {
+		t.Errorf("unexpected result, expected %s but got %s", expect, res)
+	}
+	if calls != 3 {
+		t.Errorf("expected values not needing groups to be encoded once, got %d calls for 3 values", calls)
+	}
+}
+
+type userRef struct {
+	ID   string
+	Name string
+}
+
+func (u *userRef) GroupUnmarshalerJSON(ctx context.Context, st *pjson.GroupState, data []byte) error {
+	if err := pjson.Unmarshal(data, &u.ID); err != nil {
+		return err
+	}
+	v, err := st.FetchMap("users", u.ID, resolverUsers, pjson.GroupMissingKey(pjson.MissingKeyError))
+	if err != nil {
+		return err
+	}
+	u.Name = v.(string)
+	return nil
+}
+
+var resolverUsersCalls int
+
+func resolverUsers(ctx context.Context, keys []string) (map[string]any, map[string]error, error) {
+	resolverUsersCalls += 1
+	res := make(map[string]any)
+	for _, k := range keys {
+		if k != "u_unknown" {
+			res[k] = "name of " + k
+		}
+	}
+	return res, nil, nil
+}
+
+type documentWithRefs struct {
+	Owner   *userRef
+	Members []userRef
+}
+
+func TestGroupsUnmarshal(t *testing.T) {
+	resolverUsersCalls = 0
+	var doc documentWithRefs
+	err := pjson.Unmarshal([]byte(`{"Owner":"u_1","Members":["u_2","u_1","u_3","u_4","u_5"]}`), &doc)
+	if err != nil {
+		t.Fatalf("failed to unmarshal: %s", err)
+	}
+	if resolverUsersCalls != 1 {
+		t.Errorf("expected a single resolver call, got %d", resolverUsersCalls)
+	}
+	if doc.Owner == nil || doc.Owner.Name != "name of u_1" || len(doc.Members) != 5 {
+		t.Fatalf("unexpected result: %+v", doc)
+	}
+	for _, m := range doc.Members {
+		if m.Name != "name of "+m.ID {
+			t.Errorf("unexpected member: %+v", m)
+		}
+	}
+
+	// values copied by maps and by growing slices
+	var refs map[string][]map[string]userRef
+	err = pjson.Unmarshal([]byte(`{"a":[{"x":"u_1","y":"u_2"},{"z":"u_3"}],"b":[{"x":"u_4"}]}`), &refs)
+	if err != nil {
+		t.Fatalf("failed to unmarshal: %s", err)
+	}
+	if len(refs) != 2 || len(refs["a"]) != 2 || len(refs["b"]) != 1 {
+		t.Fatalf("unexpected result: %+v", refs)
+	}
+	for k, l := range refs {
+		for _, m := range l {
+			for _, u := range m {
+				if u.ID == "" || u.Name != "name of "+u.ID {
+					t.Errorf("unexpected value in %s: %+v", k, u)
+				}
+			}
+		}
+	}
+
+	err = pjson.Unmarshal([]byte(`{"Owner":"u_1","Members":["u_2","u_unknown"]}`), &doc)
+	var groupErr *pjson.GroupUnmarshalError
+	if !errors.As(err, &groupErr) || !errors.Is(err, pjson.ErrGroupKeyNotFound) {
+		t.Fatalf("expected GroupUnmarshalError wrapping ErrGroupKeyNotFound, got %v", err)
+	}
+	if groupErr.Field != "Members" || groupErr.Struct != "documentWithRefs" {
+		t.Errorf("unexpected error location %s.%s", groupErr.Struct, groupErr.Field)
+	}
+
+	// decoders without a context
+	resolverUsersCalls = 0
+	doc = documentWithRefs{}
+	dec := pjson.NewDecoder(strings.NewReader(`{"Owner":"u_1","Members":["u_2"]} {"Owner":"u_3"}`))
+	for range 2 {
+		if err := dec.Decode(&doc); err != nil {
+			t.Fatalf("failed to decode: %s", err)
+		}
+	}
+	if resolverUsersCalls != 2 || doc.Owner == nil || doc.Owner.Name != "name of u_3" {
+		t.Errorf("unexpected decoder result after %d calls: %+v", resolverUsersCalls, doc)
+	}
+}
+
+func TestGroupsSeed(t *testing.T) {
+	var calls [][]string
+	resolver := func(ctx context.Context, keys []string) ([]any, error) {
+		calls = append(calls, keys)
+		return resolverA(ctx, keys)
+	}
+
+	st := pjson.NewGroupState()
+	st.Seed("seeded", "me", "current user")
+	ctx := pjson.ContextGroupState(context.Background(), st)
+
+	res, err := pjson.MarshalContext(ctx, []any{pjson.GroupCall("seeded", "me", resolver)})
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if string(res) != `["current user"]` {
+		t.Errorf(`unexpected result, expected ["current user"] but got %s`, res)
+	}
+	if len(calls) != 0 {
+		t.Errorf("expected no resolver call, got %v", calls)
+	}
+
+	var buf strings.Builder
+	enc := pjson.NewEncoder(&buf)
+	enc.SetGroupState(st)
+	for _, k := range []string{"me", "other", "other"} {
+		if err := enc.Encode(pjson.GroupCall("seeded", k, resolver)); err != nil {
+			t.Fatalf("failed to encode: %s", err)
+		}
+	}
+	if buf.String() != "\"current user\"\n\"OTHER\"\n\"OTHER\"\n" {
+		t.Errorf("unexpected encoder output: %q", buf.String())
+	}
+	if len(calls) != 1 || len(calls[0]) != 1 || calls[0][0] != "other" {
+		t.Errorf("expected a single resolver call for other, got %v", calls)
+	}
+
+	// resolver errors are not kept across encodings
+	fail := true
+	flaky := func(ctx context.Context, keys []string) ([]any, error) {
+		if fail {
+			return nil, errors.New("transient")
+		}
+		return resolverA(ctx, keys)
+	}
+	if err := enc.Encode(pjson.GroupCall("flaky", "a", flaky)); err == nil {
+		t.Errorf("expected an error from the failing resolver")
+	}
+	fail = false
+	buf.Reset()
+	for _, k := range []string{"a", "b"} {
+		if err := enc.Encode(pjson.GroupCall("flaky", k, flaky)); err != nil {
+			t.Fatalf("failed to encode after resolver recovered: %s", err)
+		}
+	}
+	if buf.String() != "\"A\"\n\"B\"\n" {
+		t.Errorf("unexpected encoder output: %q", buf.String())
+	}
+}
+
+func TestGroupsEncodeBatch(t *testing.T) {
+	var calls [][]string
+	resolver := func(ctx context.Context, keys []string) ([]any, error) {
+		calls = append(calls, keys)
+		return resolverA(ctx, keys)
+	}
+
+	var rows []any
+	for _, k := range []string{"a", "b", "a", "c"} {
+		rows = append(rows, map[string]any{"id": k, "v": pjson.GroupCall("batch", k, resolver)})
+	}
+	rows = append(rows, 42)
+
+	var buf strings.Builder
+	enc := pjson.NewEncoder(&buf)
+	if err := enc.EncodeBatch(rows...); err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	expect := "{\"id\":\"a\",\"v\":\"A\"}\n{\"id\":\"b\",\"v\":\"B\"}\n{\"id\":\"a\",\"v\":\"A\"}\n{\"id\":\"c\",\"v\":\"C\"}\n42\n"
+	if buf.String() != expect {
+		t.Errorf("unexpected encoder output: %q", buf.String())
+	}
+	if len(calls) != 1 || len(calls[0]) != 3 {
+		t.Errorf("expected a single resolver call with 3 keys, got %v", calls)
+	}
+}
+
+type objectG struct {
+	key string
+}
+
+func (o *objectG) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	v, err := st.FetchMap("resolverE", o.key, resolverE)
+	if err != nil {
+		return nil, err
+	}
+	return pjson.MarshalContext(ctx, v)
+}
+
+func (o *objectG) MarshalJSON() ([]byte, error) {
+	return pjson.Marshal(map[string]string{"id": o.key})
+}
+
+func TestGroupsDegraded(t *testing.T) {
+	tst := []any{&objectG{key: "foo"}, &objectG{key: "fail1"}, &objectE{key: "fail2"}}
+
+	_, err := pjson.Marshal(tst)
+	var partial *pjson.GroupPartialError
+	if err == nil || errors.As(err, &partial) {
+		t.Errorf("expected encoding to fail by default, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		policy pjson.GroupErrorPolicy
+		expect string
+	}{
+		{pjson.GroupErrorFallback, `["FOO",{"id":"fail1"},null]`},
+		{pjson.GroupErrorNull, `["FOO",null,null]`},
+	} {
+		ctx := pjson.ContextGroupErrorPolicy(context.Background(), tc.policy)
+		res, err := pjson.MarshalContext(ctx, tst)
+		if string(res) != tc.expect {
+			t.Errorf("unexpected result, expected %s but got %s", tc.expect, res)
+		}
+		if !errors.As(err, &partial) || len(partial.Errors) != 2 {
+			t.Fatalf("expected GroupPartialError with 2 errors, got %v", err)
+		}
+		if partial.Errors[0].Group != "resolverE" || partial.Errors[0].Key != "fail1" {
+			t.Errorf("unexpected first error: %v", partial.Errors[0])
+		}
+	}
+
+	// per group policy takes precedence over the context
+	ctx := pjson.ContextGroupErrorPolicy(context.Background(), pjson.GroupErrorNull)
+	tst = []any{&objectE{key: "fail", opts: []pjson.GroupOption{pjson.GroupOnError(pjson.GroupErrorFail)}}}
+	if _, err := pjson.MarshalContext(ctx, tst); err == nil || errors.As(err, &partial) {
+		t.Errorf("expected encoding to fail, got %v", err)
+	}
+
+	// degraded output is indented and returned by MarshalIndent
+	nullOpts := []pjson.GroupOption{pjson.GroupOnError(pjson.GroupErrorNull)}
+	res, err := pjson.MarshalIndent([]any{&objectE{key: "fail", opts: nullOpts}}, "", " ")
+	if string(res) != "[\n null\n]" || !errors.As(err, &partial) {
+		t.Errorf("unexpected MarshalIndent result %q, %v", res, err)
+	}
+
+	// degraded nested encodings are reported by the outer encoding
+	res, err = pjson.Marshal([]any{nestedDegraded{&objectE{key: "fail", opts: nullOpts}}, "ok"})
+	if string(res) != `[{"inner":null},"ok"]` {
+		t.Errorf("unexpected result for nested degraded encoding: %s", res)
+	}
+	if !errors.As(err, &partial) || len(partial.Errors) != 1 || partial.Errors[0].Key != "fail" {
+		t.Errorf("expected GroupPartialError from nested encoding, got %v", err)
+	}
+}
+
+type nestedDegraded struct {
+	inner any
+}
+
+func (n nestedDegraded) MarshalContextJSON(ctx context.Context) ([]byte, error) {
+	return pjson.MarshalContext(ctx, map[string]any{"inner": n.inner})
+}
+
+func TestGroupsBatchSize(t *testing.T) {
+	var lk sync.Mutex
+	var calls [][]string
+	var running, maxRunning int
+	resolver := func(ctx context.Context, keys []string) ([]any, error) {
+		lk.Lock()
+		calls = append(calls, keys)
+		running += 1
+		maxRunning = max(maxRunning, running)
+		lk.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lk.Lock()
+		running -= 1
+		lk.Unlock()
+		if slices.Contains(keys, "k9") {
+			return nil, errors.New("batch failed")
+		}
+		return resolverA(ctx, keys)
+	}
+
+	for _, concurrency := range []int{0, 2} {
+		calls = nil
+		maxRunning = 0
+		var tst []any
+		for i := range 10 {
+			tst = append(tst, pjson.GroupCall("chunked", "k"+strconv.Itoa(i), resolver))
+		}
+		// options are taken from the first fetch of the group
+		tst[0] = &objectH{key: "k0", resolver: resolver, opts: []pjson.GroupOption{
+			pjson.GroupBatchSize(3),
+			pjson.GroupBatchConcurrency(concurrency),
+			pjson.GroupOnError(pjson.GroupErrorNull),
+		}}
+
+		res, err := pjson.Marshal(tst)
+		var partial *pjson.GroupPartialError
+		if !errors.As(err, &partial) || len(partial.Errors) != 1 {
+			t.Fatalf("expected GroupPartialError for the failed batch, got %v", err)
+		}
+		expect := `["K0","K1","K2","K3","K4","K5","K6","K7","K8",null]`
+		if string(res) != expect {
+			t.Errorf("unexpected result, expected %s but got %s", expect, res)
+		}
+		if len(calls) != 4 {
+			t.Errorf("expected 4 resolver calls, got %v", calls)
+		}
+		for _, c := range calls {
+			if len(c) > 3 {
+				t.Errorf("resolver called with %d keys, expected at most 3", len(c))
+			}
+		}
+		if expectRunning := max(concurrency, 1); maxRunning != expectRunning {
+			t.Errorf("expected %d resolver calls running concurrently, got %d", expectRunning, maxRunning)
+		}
+	}
+}
+
+type objectH struct {
+	key      string
+	resolver pjson.GroupResolveFunc
+	opts     []pjson.GroupOption
+}
+
+func (o *objectH) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	v, err := st.Fetch("chunked", o.key, o.resolver, o.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return pjson.MarshalContext(ctx, v)
+}
+
+type localeParams struct {
+	Locale string
+}
+
+type objectLocalized struct {
+	key    string
+	locale string
+}
+
+func (o *objectLocalized) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	v, err := st.FetchParams("greet", o.key, localeParams{o.locale}, resolverLocalized)
+	if err != nil {
+		return nil, err
+	}
+	return st.Marshal(ctx, v)
+}
+
+type objectParams struct {
+	key      string
+	params   any
+	resolver pjson.GroupResolveParamsFunc
+}
+
+func (o *objectParams) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	v, err := st.FetchParams("greet", o.key, o.params, o.resolver)
+	if err != nil {
+		return nil, err
+	}
+	return st.Marshal(ctx, v)
+}
+
+var localizedCalls sync.Map
+
+func resolverLocalized(ctx context.Context, keys []string, params any) ([]any, error) {
+	p := params.(localeParams)
+	sorted := slices.Sorted(slices.Values(keys))
+	localizedCalls.Store(p.Locale, strings.Join(sorted, ","))
+	res := make([]any, len(keys))
+	for n, k := range keys {
+		res[n] = p.Locale + ":" + k
+	}
+	return res, nil
+}
+
+func TestGroupsParams(t *testing.T) {
+	obj := []any{
+		&objectLocalized{"a", "en"},
+		&objectLocalized{"b", "fr"},
+		&objectLocalized{"c", "en"},
+		&objectLocalized{"a", "fr"},
+	}
+	st := pjson.NewGroupState()
+	res, err := pjson.MarshalContext(pjson.ContextGroupState(context.Background(), st), obj)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if string(res) != `["en:a","fr:b","en:c","fr:a"]` {
+		t.Errorf("unexpected result: %s", res)
+	}
+	for locale, keys := range map[string]string{"en": "a,c", "fr": "a,b"} {
+		if v, _ := localizedCalls.Load(locale); v != keys {
+			t.Errorf("expected resolver call for %s with keys %s, got %v", locale, keys, v)
+		}
+	}
+	stats := st.Stats()
+	if stats.Rounds != 1 {
+		t.Errorf("expected 1 round, got %d", stats.Rounds)
+	}
+	name := `greet(pjson_test.localeParams{Locale:"en"})`
+	if s := stats.Groups[name]; s.Calls != 1 || s.Keys != 2 {
+		t.Errorf("unexpected stats for %s: %+v", name, s)
+	}
+
+	// params of distinct types are distinct partitions
+	type otherParams struct {
+		Locale string
+	}
+	var other []any
+	resolverOther := func(ctx context.Context, keys []string, params any) ([]any, error) {
+		other = append(other, params)
+		return resolverA(ctx, keys)
+	}
+	obj = []any{&objectLocalized{"a", "en"}, &objectParams{"b", otherParams{"en"}, resolverOther}}
+	res, err = pjson.Marshal(obj)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if string(res) != `["en:a","B"]` {
+		t.Errorf("unexpected result: %s", res)
+	}
+	if len(other) != 1 || other[0] != (otherParams{"en"}) {
+		t.Errorf("expected resolver to be called with otherParams, got %v", other)
+	}
+
+	if _, err := st.FetchParams("greet", "a", []string{"en"}, resolverOther); err == nil {
+		t.Errorf("expected error for non-comparable params")
+	}
+}
+
+type objectAsync struct {
+	group string
+	key   string
+	fn    pjson.GroupResolveAsyncFunc
+}
+
+func (o *objectAsync) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	v, err := st.FetchAsync(o.group, o.key, o.fn)
+	if err != nil {
+		return nil, err
+	}
+	return st.Marshal(ctx, v)
+}
+
+func TestGroupsAsync(t *testing.T) {
+	var lk sync.Mutex
+	var started []string
+	var seen [][]string
+	resolver := func(group string) pjson.GroupResolveAsyncFunc {
+		return func(ctx context.Context, keys []string) pjson.GroupFuture {
+			lk.Lock()
+			started = append(started, group)
+			lk.Unlock()
+			return pjson.GroupFutureFunc(func(ctx context.Context) ([]any, error) {
+				lk.Lock()
+				seen = append(seen, slices.Clone(started))
+				lk.Unlock()
+				return resolverA(ctx, keys)
+			})
+		}
+	}
+	a, b := resolver("a"), resolver("b")
+	obj := []any{
+		&objectAsync{"a", "x", a},
+		&objectAsync{"b", "y", b},
+		&objectAsync{"a", "z", a},
+	}
+
+	res, err := pjson.MarshalContext(pjson.ContextGroupConcurrency(context.Background(), 1), obj)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if string(res) != `["X","Y","Z"]` {
+		t.Errorf("unexpected result: %s", res)
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected 2 waits, got %d", len(seen))
+	}
+	for _, s := range seen {
+		if len(s) != 2 {
+			t.Errorf("expected both resolvers to be started before waiting, got %v", s)
+		}
+	}
+}
+
+type fieldsUser struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type fieldsUserRef struct {
+	group string
+	id    string
+	calls *int
+}
+
+func (r *fieldsUserRef) GroupMarshalerJSON(ctx context.Context, st *pjson.GroupState) ([]byte, error) {
+	v, err := st.Fetch(r.group, r.id, func(ctx context.Context, keys []string) ([]any, error) {
+		*r.calls += 1
+		res := make([]any, len(keys))
+		for n, k := range keys {
+			res[n] = &fieldsUser{ID: k, Name: strings.ToUpper(k), Email: k + "@example.com"}
+		}
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return st.Marshal(ctx, v)
+}
+
+type fieldsDocument struct {
+	ID      string            `json:"id"`
+	Title   string            `json:"title"`
+	Owner   *fieldsUserRef    `json:"owner"`
+	Manager *fieldsUserRef    `json:"manager"`
+	Tags    map[string]string `json:"tags"`
+	Items   []fieldsUser      `json:"items"`
+}
+
+func TestGroupsFields(t *testing.T) {
+	var ownerCalls, managerCalls int
+	doc := &fieldsDocument{
+		ID:      "d1",
+		Title:   "doc",
+		Owner:   &fieldsUserRef{"owners", "alice", &ownerCalls},
+		Manager: &fieldsUserRef{"managers", "bob", &managerCalls},
+		Tags:    map[string]string{"a": "1", "b": "2"},
+		Items:   []fieldsUser{{ID: "i1", Name: "one"}, {ID: "i2", Name: "two"}},
+	}
+
+	ctx := pjson.ContextFields(context.Background(), "id", "owner.name", "tags.b", "items.id", "items")
+	res, err := pjson.MarshalContext(ctx, doc)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	expect := `{"id":"d1","owner":{"name":"ALICE"},"tags":{"b":"2"},"items":[{"id":"i1","name":"one","email":""},{"id":"i2","name":"two","email":""}]}`
+	if string(res) != expect {
+		t.Errorf("unexpected result, expected %s but got %s", expect, res)
+	}
+	if ownerCalls != 1 || managerCalls != 0 {
+		t.Errorf("expected only owners to be resolved, got %d owners and %d managers calls", ownerCalls, managerCalls)
+	}
+}
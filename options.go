@@ -0,0 +1,103 @@
+package pjson
+
+import (
+	"context"
+	"io"
+)
+
+// MarshalOptions configures encodings. The options are stored in the context
+// of the encoding, so that nested calls to MarshalContext made by marshalers
+// inherit them.
+type MarshalOptions struct {
+	DisableHTMLEscape bool     // do not escape &, <, and > in strings, see Encoder.SetEscapeHTML
+	Prefix            string   // prefix of indented output, see MarshalIndent
+	Indent            string   // indentation of output, see MarshalIndent
+	Public            bool     // omit fields marked "protect", see ContextPublic
+	Scopes            []string // scopes granted to the encoding if not nil, see ContextScopes
+}
+
+// Context returns a context carrying o, to be used with MarshalContext or
+// NewEncoderContext.
+func (o MarshalOptions) Context(parent context.Context) context.Context {
+	ctx := parent
+	if o.Public {
+		ctx = ContextPublic(ctx)
+	}
+	if o.Scopes != nil {
+		ctx = ContextScopes(ctx, o.Scopes...)
+	}
+	return context.WithValue(ctx, jsonOptionMarshalOptions, &o)
+}
+
+// Marshal returns the JSON encoding of v using o.
+func (o MarshalOptions) Marshal(v any) ([]byte, error) {
+	return MarshalContext(o.Context(context.Background()), v)
+}
+
+// MarshalContext returns the JSON encoding of v using o and ctx.
+func (o MarshalOptions) MarshalContext(ctx context.Context, v any) ([]byte, error) {
+	return MarshalContext(o.Context(ctx), v)
+}
+
+// NewEncoder returns a new encoder using o that writes to w.
+func (o MarshalOptions) NewEncoder(w io.Writer) *Encoder {
+	return NewEncoderContext(o.Context(context.Background()), w)
+}
+
+func marshalOptionsFromContext(ctx context.Context) *MarshalOptions {
+	o, _ := ctx.Value(jsonOptionMarshalOptions).(*MarshalOptions)
+	return o
+}
+
+// encOptsFromContext returns the encOpts of encodings using ctx.
+func encOptsFromContext(ctx context.Context) encOpts {
+	opts := encOpts{escapeHTML: true}
+	if o := marshalOptionsFromContext(ctx); o != nil {
+		opts.escapeHTML = !o.DisableHTMLEscape
+	}
+	return opts
+}
+
+// UnmarshalOptions configures decodings. The options are stored in the
+// context of the decoding, so that nested calls to UnmarshalContext made by
+// unmarshalers inherit them.
+type UnmarshalOptions struct {
+	UseNumber             bool // see Decoder.UseNumber
+	DisallowUnknownFields bool // see Decoder.DisallowUnknownFields
+	Public                bool // ignore fields marked "protect" or "readonly", see ContextPublic
+	Strict                bool // reject fields that cannot be set, see ContextStrict
+}
+
+// Context returns a context carrying o, to be used with UnmarshalContext or
+// NewDecoderContext.
+func (o UnmarshalOptions) Context(parent context.Context) context.Context {
+	ctx := parent
+	if o.Public {
+		ctx = ContextPublic(ctx)
+	}
+	if o.Strict {
+		ctx = ContextStrict(ctx)
+	}
+	return context.WithValue(ctx, jsonOptionUnmarshalOptions, &o)
+}
+
+// Unmarshal parses the JSON-encoded data using o and stores the result in
+// the value pointed to by v.
+func (o UnmarshalOptions) Unmarshal(data []byte, v any) error {
+	return UnmarshalContext(o.Context(context.Background()), data, v)
+}
+
+// UnmarshalContext is like Unmarshal but also uses ctx.
+func (o UnmarshalOptions) UnmarshalContext(ctx context.Context, data []byte, v any) error {
+	return UnmarshalContext(o.Context(ctx), data, v)
+}
+
+// NewDecoder returns a new decoder using o that reads from r.
+func (o UnmarshalOptions) NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderContext(o.Context(context.Background()), r)
+}
+
+func unmarshalOptionsFromContext(ctx context.Context) *UnmarshalOptions {
+	o, _ := ctx.Value(jsonOptionUnmarshalOptions).(*UnmarshalOptions)
+	return o
+}
@@ -3,6 +3,11 @@ package pjson_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/KarpelesLab/pjson"
@@ -372,3 +377,394 @@ func TestUnmarshalerContextWithArray(t *testing.T) {
 		t.Errorf("Expected Ctx=\"array-context\", got %q", container.Ctx)
 	}
 }
+
+// Test scope tag
+
+type scopedStruct struct {
+	Name   string `json:"name"`
+	Email  string `json:"email,scope=owner|admin"`
+	Notes  string `json:"notes,scope=admin"`
+	Secret string `json:"secret,protect"`
+}
+
+func TestScopes(t *testing.T) {
+	obj := &scopedStruct{Name: "user", Email: "user@example.com", Notes: "note", Secret: "hidden"}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"unrestricted", context.Background(), `{"name":"user","email":"user@example.com","notes":"note","secret":"hidden"}`},
+		{"public", pjson.ContextPublic(context.Background()), `{"name":"user"}`},
+		{"no scopes", pjson.ContextScopes(context.Background()), `{"name":"user","secret":"hidden"}`},
+		{"owner", pjson.ContextScopes(context.Background(), "owner"), `{"name":"user","email":"user@example.com","secret":"hidden"}`},
+		{"admin", pjson.ContextScopes(context.Background(), "member", "admin"), `{"name":"user","email":"user@example.com","notes":"note","secret":"hidden"}`},
+		{"public owner", pjson.ContextScopes(pjson.ContextPublic(context.Background()), "owner"), `{"name":"user","email":"user@example.com"}`},
+	}
+	for _, tt := range tests {
+		res, err := pjson.MarshalContext(tt.ctx, obj)
+		if err != nil {
+			t.Fatalf("%s: MarshalContext failed: %v", tt.name, err)
+		}
+		if string(res) != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, res)
+		}
+	}
+}
+
+// Test protect tag on decode
+
+func TestProtectDecode(t *testing.T) {
+	input := []byte(`{"name":"mallory","is_admin":true,"inner":{"public":"p","secret":"s"}}`)
+	type request struct {
+		userWithProtectedFields
+		Inner innerSecret `json:"inner"`
+	}
+
+	// Normal unmarshal sets protected fields
+	var req request
+	if err := pjson.Unmarshal(input, &req); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !req.IsAdmin || req.Inner.Secret != "s" {
+		t.Errorf("Expected protected fields to be set, got %+v", req)
+	}
+
+	// Public unmarshal skips protected fields
+	ctx := pjson.ContextPublic(context.Background())
+	req = request{}
+	if err := pjson.UnmarshalContext(ctx, input, &req); err != nil {
+		t.Fatalf("UnmarshalContext failed: %v", err)
+	}
+	if req.IsAdmin || req.Inner.Secret != "" {
+		t.Errorf("Expected protected fields to be skipped in public mode, got %+v", req)
+	}
+	if req.Name != "mallory" || req.Inner.Public != "p" {
+		t.Errorf("Expected other fields to be set in public mode, got %+v", req)
+	}
+
+	// Strict public unmarshal rejects protected fields
+	req = request{}
+	err := pjson.UnmarshalContext(pjson.ContextStrict(ctx), input, &req)
+	var perr *pjson.ProtectedFieldError
+	if !errors.As(err, &perr) {
+		t.Fatalf("Expected ProtectedFieldError, got %v", err)
+	}
+	if perr.Struct != "request" || perr.Field != "is_admin" {
+		t.Errorf("Expected error for request.is_admin, got %s.%s", perr.Struct, perr.Field)
+	}
+
+	req = request{}
+	err = pjson.UnmarshalContext(pjson.ContextStrict(ctx), []byte(`{"inner":{"secret":"s"}}`), &req)
+	if !errors.As(err, &perr) || perr.Field != "inner.secret" {
+		t.Errorf("Expected ProtectedFieldError for inner.secret, got %v", err)
+	}
+}
+
+// Test readonly and writeonly tags
+
+type accountFields struct {
+	ID       int    `json:"id,readonly"`
+	Name     string `json:"name"`
+	Password string `json:"password,writeonly"`
+}
+
+func TestReadonlyWriteonly(t *testing.T) {
+	res, err := pjson.Marshal(&accountFields{ID: 1, Name: "john", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(res) != `{"id":1,"name":"john"}` {
+		t.Errorf("Expected writeonly field to be omitted, got %s", res)
+	}
+
+	// readonly fields are only ignored in public mode
+	input := []byte(`{"id":2,"name":"jane","password":"pass"}`)
+	var acc accountFields
+	if err := pjson.Unmarshal(input, &acc); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if acc != (accountFields{ID: 2, Name: "jane", Password: "pass"}) {
+		t.Errorf("Expected readonly field to be set, got %+v", acc)
+	}
+
+	public := pjson.ContextPublic(context.Background())
+	acc = accountFields{ID: 1}
+	if err := pjson.UnmarshalContext(public, input, &acc); err != nil {
+		t.Fatalf("UnmarshalContext failed: %v", err)
+	}
+	if acc != (accountFields{ID: 1, Name: "jane", Password: "pass"}) {
+		t.Errorf("Expected readonly field to be ignored in public mode, got %+v", acc)
+	}
+
+	if err := pjson.UnmarshalContext(pjson.ContextStrict(context.Background()), input, &acc); err != nil {
+		t.Errorf("Expected strict non-public unmarshal to succeed, got %v", err)
+	}
+	err = pjson.UnmarshalContext(pjson.ContextStrict(public), input, &acc)
+	var rerr *pjson.ReadonlyFieldError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("Expected ReadonlyFieldError, got %v", err)
+	}
+	if rerr.Struct != "accountFields" || rerr.Field != "id" {
+		t.Errorf("Expected error for accountFields.id, got %s.%s", rerr.Struct, rerr.Field)
+	}
+}
+
+// Test redact tag and Redactor
+
+type paymentFields struct {
+	Name   string `json:"name"`
+	Card   string `json:"card,redact"`
+	Token  string `json:"token,protect"`
+	Amount int    `json:"amount,redact"`
+}
+
+func TestRedact(t *testing.T) {
+	obj := &paymentFields{Name: "john", Card: "4111111111111234", Token: "tok", Amount: 42}
+	public := pjson.ContextPublic(context.Background())
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"plain", context.Background(), `{"name":"john","card":"4111111111111234","token":"tok","amount":42}`},
+		{"public", public, `{"name":"john","card":"***","amount":"***"}`},
+		{"audit", pjson.ContextRedactor(context.Background(), pjson.RedactLast4), `{"name":"john","card":"***1234","token":"tok","amount":null}`},
+		{"public null", pjson.ContextRedactor(public, pjson.RedactNull), `{"name":"john","card":null,"token":null,"amount":null}`},
+		{"public mask", pjson.ContextRedactor(public, pjson.RedactMask("[hidden]")), `{"name":"john","card":"[hidden]","token":"[hidden]","amount":"[hidden]"}`},
+	}
+	for _, tt := range tests {
+		res, err := pjson.MarshalContext(tt.ctx, obj)
+		if err != nil {
+			t.Fatalf("%s: MarshalContext failed: %v", tt.name, err)
+		}
+		if string(res) != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, res)
+		}
+	}
+
+	failing := pjson.RedactorFunc(func(ctx context.Context, v any) ([]byte, error) {
+		return nil, errors.New("no redaction")
+	})
+	_, err := pjson.MarshalContext(pjson.ContextRedactor(public, failing), obj)
+	var merr *pjson.MarshalerError
+	if !errors.As(err, &merr) {
+		t.Errorf("Expected MarshalerError, got %v", err)
+	}
+}
+
+// Test FieldFilter
+
+type viewerProfile struct {
+	Owner string `json:"owner"`
+	Email string `json:"email,viewer"`
+	Phone string `json:"phone,omitempty,viewer"`
+}
+
+func TestFieldFilter(t *testing.T) {
+	filter := func(ctx context.Context, parent reflect.Value, f pjson.FieldInfo) bool {
+		if _, ok := f.Option("viewer"); !ok {
+			return true
+		}
+		viewer, _ := ctx.Value(ctxKey("viewer")).(string)
+		return parent.Field(0).String() == viewer
+	}
+	profiles := []viewerProfile{
+		{Owner: "alice", Email: "alice@example.com", Phone: "123"},
+		{Owner: "bob", Email: "bob@example.com"},
+	}
+
+	ctx := pjson.ContextFieldFilter(context.Background(), filter)
+	ctx = context.WithValue(ctx, ctxKey("viewer"), "alice")
+	res, err := pjson.MarshalContext(ctx, profiles)
+	if err != nil {
+		t.Fatalf("MarshalContext failed: %v", err)
+	}
+	expect := `[{"owner":"alice","email":"alice@example.com","phone":"123"},{"owner":"bob"}]`
+	if string(res) != expect {
+		t.Errorf("Expected %s, got %s", expect, res)
+	}
+}
+
+// Test TextMarshalerContext and TextUnmarshalerContext
+
+type tenantID int
+
+func (id tenantID) MarshalContextText(ctx context.Context) ([]byte, error) {
+	tenant, _ := ctx.Value(ctxKey("tenant")).(string)
+	return []byte(tenant + "-" + strconv.Itoa(int(id))), nil
+}
+
+func (id *tenantID) UnmarshalContextText(ctx context.Context, text []byte) error {
+	tenant, _ := ctx.Value(ctxKey("tenant")).(string)
+	s, ok := strings.CutPrefix(string(text), tenant+"-")
+	if !ok {
+		return fmt.Errorf("id %s does not belong to tenant %s", text, tenant)
+	}
+	n, err := strconv.Atoi(s)
+	*id = tenantID(n)
+	return err
+}
+
+type tenantName string
+
+func (n tenantName) MarshalContextText(ctx context.Context) ([]byte, error) {
+	tenant, _ := ctx.Value(ctxKey("tenant")).(string)
+	return []byte(tenant + "-" + string(n)), nil
+}
+
+func (n *tenantName) UnmarshalContextText(ctx context.Context, text []byte) error {
+	tenant, _ := ctx.Value(ctxKey("tenant")).(string)
+	s, ok := strings.CutPrefix(string(text), tenant+"-")
+	if !ok {
+		return fmt.Errorf("name %s does not belong to tenant %s", text, tenant)
+	}
+	*n = tenantName(s)
+	return nil
+}
+
+type tenantDocument struct {
+	ID    tenantID            `json:"id"`
+	Links map[tenantID]string `json:"links"`
+}
+
+func TestTextMarshalerContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ctxKey("tenant"), "acme")
+	doc := &tenantDocument{ID: 1, Links: map[tenantID]string{2: "parent"}}
+
+	res, err := pjson.MarshalContext(ctx, doc)
+	if err != nil {
+		t.Fatalf("MarshalContext failed: %v", err)
+	}
+	expect := `{"id":"acme-1","links":{"acme-2":"parent"}}`
+	if string(res) != expect {
+		t.Errorf("Expected %s, got %s", expect, res)
+	}
+
+	var out tenantDocument
+	if err := pjson.UnmarshalContext(ctx, res, &out); err != nil {
+		t.Fatalf("UnmarshalContext failed: %v", err)
+	}
+	if out.ID != 1 || out.Links[2] != "parent" {
+		t.Errorf("Unexpected result %+v", out)
+	}
+
+	other := context.WithValue(context.Background(), ctxKey("tenant"), "other")
+	if err := pjson.UnmarshalContext(other, res, &out); err == nil {
+		t.Errorf("Expected error decoding ids of another tenant")
+	}
+
+	// string keys use MarshalContextText as values do
+	names := map[tenantName]tenantName{"1": "2"}
+	res, err = pjson.MarshalContext(ctx, names)
+	if err != nil {
+		t.Fatalf("MarshalContext failed: %v", err)
+	}
+	expect = `{"acme-1":"acme-2"}`
+	if string(res) != expect {
+		t.Errorf("Expected %s, got %s", expect, res)
+	}
+	var outNames map[tenantName]tenantName
+	if err := pjson.UnmarshalContext(ctx, res, &outNames); err != nil {
+		t.Fatalf("UnmarshalContext failed: %v", err)
+	}
+	if len(outNames) != 1 || outNames["1"] != "2" {
+		t.Errorf("Unexpected result %+v", outNames)
+	}
+}
+
+// Test context cancellation
+
+func TestContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	values := make([]int, 5000)
+	if _, err := pjson.MarshalContext(ctx, values); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected marshal to fail with context.Canceled, got %v", err)
+	}
+	if _, err := pjson.MarshalContext(ctx, map[string][]int{"a": values}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected marshal of map to fail with context.Canceled, got %v", err)
+	}
+
+	data, err := pjson.Marshal(values)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var ints []int
+	if err := pjson.UnmarshalContext(ctx, data, &ints); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected unmarshal to fail with context.Canceled, got %v", err)
+	}
+	var v any
+	data = []byte(`{"a":` + string(data) + `,"b":[1,2]}`)
+	if err := pjson.UnmarshalContext(ctx, data, &v); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected unmarshal into interface to fail with context.Canceled, got %v", err)
+	}
+}
+
+// Test MarshalOptions and UnmarshalOptions
+
+type nestedOptions struct {
+	Inner map[string]string
+}
+
+func (n nestedOptions) MarshalContextJSON(ctx context.Context) ([]byte, error) {
+	return pjson.MarshalContext(ctx, n.Inner)
+}
+
+type nestedNumber struct {
+	Value any
+}
+
+func (n *nestedNumber) UnmarshalContextJSON(ctx context.Context, data []byte) error {
+	return pjson.UnmarshalContext(ctx, data, &n.Value)
+}
+
+func TestMarshalOptions(t *testing.T) {
+	obj := map[string]any{
+		"nested": nestedOptions{map[string]string{"html": "<b>"}},
+		"secret": &mixedTagsStruct{Name: "n", Secret: "s"},
+	}
+	o := pjson.MarshalOptions{DisableHTMLEscape: true, Indent: " ", Public: true}
+	res, err := o.Marshal(obj)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	expect := "{\n \"nested\": {\n  \"html\": \"<b>\"\n },\n \"secret\": {\n  \"name\": \"n\"\n }\n}"
+	if string(res) != expect {
+		t.Errorf("Expected %s, got %s", expect, res)
+	}
+
+	var buf strings.Builder
+	if err := o.NewEncoder(&buf).Encode(obj); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if buf.String() != expect+"\n" {
+		t.Errorf("Expected encoder output %s, got %s", expect, buf.String())
+	}
+
+	buf.Reset()
+	enc := pjson.NewEncoder(&buf)
+	enc.SetContext(o.Context(context.Background()))
+	if err := enc.Encode(obj); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if buf.String() != expect+"\n" {
+		t.Errorf("Expected encoder output with SetContext %s, got %s", expect, buf.String())
+	}
+
+	u := pjson.UnmarshalOptions{UseNumber: true, DisallowUnknownFields: true}
+	var n nestedNumber
+	if err := u.Unmarshal([]byte(`12.5`), &n); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if n.Value != pjson.Number("12.5") {
+		t.Errorf("Expected nested decoding to use Number, got %T %v", n.Value, n.Value)
+	}
+	var s mixedTagsStruct
+	if err := u.NewDecoder(strings.NewReader(`{"unknown":1}`)).Decode(&s); err == nil {
+		t.Errorf("Expected error for unknown field")
+	}
+}
@@ -0,0 +1,82 @@
+package pjson
+
+import (
+	"context"
+	"reflect"
+	"unicode/utf8"
+)
+
+// Redactor returns the JSON encoding written in place of sensitive values.
+//
+// When a Redactor is set with ContextRedactor, fields marked "redact" are
+// encoded using it, and so are fields marked "protect" in public mode instead
+// of being omitted. In public mode, fields marked "redact" are encoded using
+// RedactMask("***") if no Redactor is set.
+type Redactor interface {
+	Redact(ctx context.Context, v any) ([]byte, error)
+}
+
+// RedactorFunc is an adapter to use a function as a Redactor.
+type RedactorFunc func(ctx context.Context, v any) ([]byte, error)
+
+// Redact calls f(ctx, v).
+func (f RedactorFunc) Redact(ctx context.Context, v any) ([]byte, error) {
+	return f(ctx, v)
+}
+
+// RedactMask returns a Redactor replacing values with the string mask.
+func RedactMask(mask string) Redactor {
+	b := appendString(nil, mask, false)
+	return RedactorFunc(func(context.Context, any) ([]byte, error) {
+		return b, nil
+	})
+}
+
+// RedactNull is a Redactor replacing values with null.
+var RedactNull Redactor = RedactorFunc(func(context.Context, any) ([]byte, error) {
+	return []byte("null"), nil
+})
+
+// RedactLast4 is a Redactor replacing strings with a mask followed by their
+// last 4 characters, such as "***1234". Strings of 4 characters or less are
+// fully masked, and other values are replaced with null.
+var RedactLast4 Redactor = RedactorFunc(func(_ context.Context, v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.String {
+		return []byte("null"), nil
+	}
+	s := rv.String()
+	n := utf8.RuneCountInString(s)
+	if n <= 4 {
+		return appendString(nil, "***", false), nil
+	}
+	for ; n > 4; n-- {
+		_, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+	}
+	return appendString(nil, "***"+s, false), nil
+})
+
+var defaultRedactor = RedactMask("***")
+
+// redact writes the redacted encoding of v.
+func (e *encodeState) redact(v reflect.Value, opts encOpts) {
+	r := e.redactor
+	if r == nil {
+		r = defaultRedactor
+	}
+	var iv any
+	if v.CanInterface() {
+		iv = v.Interface()
+	}
+	b, err := r.Redact(e.ctx, iv)
+	if err == nil {
+		e.Grow(len(b))
+		out := e.AvailableBuffer()
+		out, err = appendCompact(out, b, opts.escapeHTML)
+		e.Buffer.Write(out)
+	}
+	if err != nil {
+		e.error(&MarshalerError{v.Type(), err, "Redact"})
+	}
+}
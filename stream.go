@@ -31,7 +31,7 @@ type Decoder struct {
 // The decoder introduces its own buffering and may
 // read data from r beyond the JSON values requested.
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r: r}
+	return NewDecoderContext(context.Background(), r)
 }
 
 // NewDecoderContext returns a new decoder that reads from r with context support.
@@ -75,6 +75,9 @@ func (dec *Decoder) Decode(v any) error {
 	}
 	dec.d.init(dec.buf[dec.scanp : dec.scanp+n])
 	dec.scanp += n
+	if dec.d.ctx == nil {
+		dec.d.ctx = context.Background()
+	}
 
 	// Don't save err from unmarshal into dec.err:
 	// the connection is still usable since we read a complete JSON
@@ -196,8 +199,10 @@ type Encoder struct {
 	indentPrefix string
 	indentValue  string
 
-	ctx    context.Context
-	public bool
+	ctx        context.Context
+	public     bool
+	groupCache GroupCache
+	groupSt    *GroupState
 }
 
 // NewEncoder returns a new encoder that writes to w.
@@ -207,10 +212,8 @@ func NewEncoder(w io.Writer) *Encoder {
 
 // NewEncoderContext returns a new encoder that writes to w with context support.
 func NewEncoderContext(ctx context.Context, w io.Writer) *Encoder {
-	enc := &Encoder{w: w, escapeHTML: true, ctx: ctx}
-	if isPublic(ctx) {
-		enc.public = true
-	}
+	enc := &Encoder{w: w, escapeHTML: true}
+	enc.SetContext(ctx)
 	return enc
 }
 
@@ -219,28 +222,81 @@ func NewEncoderContext(ctx context.Context, w io.Writer) *Encoder {
 // followed by a newline character.
 //
 // See the documentation for [Marshal] for details about the
-// conversion of Go values to JSON.
+// conversion of Go values to JSON. A [GroupPartialError] is returned
+// after writing the value if parts of it were rendered in a degraded form.
 func (enc *Encoder) Encode(v any) error {
 	if enc.err != nil {
 		return enc.err
 	}
 
-	e := newEncodeState()
+	e := enc.newEncodeState()
 	defer encodeStatePool.Put(e)
 
-	// Set context if available
+	err := e.marshal(v, encOpts{escapeHTML: enc.escapeHTML})
+	if err != nil {
+		return err
+	}
+	if err := enc.write(e); err != nil {
+		return err
+	}
+	return e.groupSt.partialError()
+}
+
+// EncodeBatch writes the JSON encoding of each of values to the stream, each
+// followed by a newline character as with Encode. Values are encoded against
+// a single GroupState, so that the groups needed by all of them are resolved
+// together. Nothing is written if encoding any of the values fails.
+//
+// As with Encode, a GroupPartialError is returned after writing the values if
+// some of them were rendered in a degraded form.
+func (enc *Encoder) EncodeBatch(values ...any) error {
+	if enc.err != nil {
+		return enc.err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	es := make([]*encodeState, len(values))
+	for n := range es {
+		es[n] = enc.newEncodeState()
+		defer encodeStatePool.Put(es[n])
+	}
+
+	err := marshalBatch(es, values, encOpts{escapeHTML: enc.escapeHTML})
+	if err != nil {
+		return err
+	}
+	for _, e := range es {
+		if err := enc.write(e); err != nil {
+			return err
+		}
+	}
+	return es[0].groupSt.partialError()
+}
+
+// newEncodeState returns an encodeState configured with the encoder settings.
+func (enc *Encoder) newEncodeState() *encodeState {
+	e := newEncodeState()
 	if enc.ctx != nil {
 		e.setContext(enc.ctx)
+	} else {
+		e.setContext(context.Background())
 	}
 	if enc.public {
 		e.public = true
 	}
-
-	err := e.marshal(v, encOpts{escapeHTML: enc.escapeHTML})
-	if err != nil {
-		return err
+	if enc.groupCache != nil {
+		e.groupCache = enc.groupCache
+	}
+	if enc.groupSt != nil {
+		e.groupSt = enc.groupSt
 	}
+	return e
+}
 
+// write writes the value encoded in e to the stream.
+func (enc *Encoder) write(e *encodeState) error {
 	// Terminate each value with a newline.
 	// This makes the output look a little nicer
 	// when debugging, and some kind of space
@@ -249,6 +305,7 @@ func (enc *Encoder) Encode(v any) error {
 	// digits coming.
 	e.WriteByte('\n')
 
+	var err error
 	b := e.Bytes()
 	if enc.indentPrefix != "" || enc.indentValue != "" {
 		enc.indentBuf, err = appendIndent(enc.indentBuf[:0], b, enc.indentPrefix, enc.indentValue)
@@ -282,12 +339,32 @@ func (enc *Encoder) SetEscapeHTML(on bool) {
 	enc.escapeHTML = on
 }
 
-// SetContext sets the context for the encoder.
+// SetContext sets the context for the encoder. The [MarshalOptions] carried
+// by ctx, if any, replace the HTML escaping and indentation settings of the
+// encoder.
 func (enc *Encoder) SetContext(ctx context.Context) {
 	enc.ctx = ctx
 	if isPublic(ctx) {
 		enc.public = true
 	}
+	if o := marshalOptionsFromContext(ctx); o != nil {
+		enc.escapeHTML = !o.DisableHTMLEscape
+		enc.indentPrefix = o.Prefix
+		enc.indentValue = o.Indent
+	}
+}
+
+// SetGroupCache sets the cache used to store values resolved by GroupState
+// across calls to Encode, overriding any cache set in the context.
+func (enc *Encoder) SetGroupCache(cache GroupCache) {
+	enc.groupCache = cache
+}
+
+// SetGroupState makes the encoder use st as the GroupState of every call to
+// Encode, so that values seeded in st or resolved by previous calls do not
+// need to be resolved again.
+func (enc *Encoder) SetGroupState(st *GroupState) {
+	enc.groupSt = st
 }
 
 // A Token holds a value of one of these types: